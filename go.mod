@@ -6,5 +6,6 @@ require (
 	github.com/gocql/gocql v0.0.0-20200624222514-34081eda590e
 	github.com/grafana/grafana-plugin-sdk-go v0.75.0
 	github.com/magefile/mage v1.10.0 // indirect
+	github.com/prometheus/client_golang v1.3.0
 	gopkg.in/inf.v0 v0.9.1
 )
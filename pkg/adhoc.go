@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// defaultTagValuesLimit is the number of rows /tag-values reads when no limit is set.
+const defaultTagValuesLimit = 1000
+
+// maxTagValuesLimit bounds the rows /tag-values may read.
+const maxTagValuesLimit = 10000
+
+// tagValue is an ad-hoc filter key or value, as expected by Grafana.
+type tagValue struct {
+	Text string `json:"text"`
+	Type string `json:"type,omitempty"`
+}
+
+// adHocTable returns the keyspace and table of an ad-hoc filter request,
+// from the keyspace and table parameters or the adHocTable setting.
+func (settings *instanceSettings) adHocTable(r *http.Request) (string, string, error) {
+	params := r.URL.Query()
+	keyspace, table := params.Get("keyspace"), params.Get("table")
+	if keyspace == "" && table == "" {
+		if parts := strings.SplitN(settings.settings.AdHocTable, ".", 2); len(parts) == 2 {
+			keyspace, table = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+	}
+	if keyspace == "" || table == "" {
+		return "", "", errors.New("keyspace and table are required, or configure adHocTable")
+	}
+	if err := checkIdentifier("keyspace", keyspace); err != nil {
+		return "", "", err
+	}
+	if err := checkIdentifier("table", table); err != nil {
+		return "", "", err
+	}
+	keyspace = settings.resolveKeyspace(keyspace)
+	return keyspace, settings.resolveTable(keyspace, table), nil
+}
+
+// handleTagKeys serves /tag-keys, the columns ad-hoc filters may use.
+func (td *SampleDatasource) handleTagKeys(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	keyspace, table, err := instance.adHocTable(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	columns, err := instance.schemaColumns(keyspace, table)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	keys := make([]tagValue, 0, len(columns))
+	for _, c := range columns {
+		keys = append(keys, tagValue{Text: c.Name, Type: c.Type})
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// handleTagValues serves /tag-values?key=column, the distinct values of a
+// column found in the first limit rows of the table.
+func (td *SampleDatasource) handleTagValues(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	keyspace, table, err := instance.adHocTable(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	params := r.URL.Query()
+	key := params.Get("key")
+	if err := checkIdentifier("column", key); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := defaultTagValuesLimit
+	if l := params.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 || limit > maxTagValuesLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxTagValuesLimit))
+			return
+		}
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM %s.%s LIMIT %d", quoteIdentifier(instance.resolveColumn(keyspace, table, key)),
+		quoteIdentifier(keyspace), quoteIdentifier(table), limit)
+	if err := instance.checkQuery(stmt); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	session, err := instance.getSession("")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	values, err := distinctValues(instance.newQuery(r.Context(), session, stmt).Iter())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, values)
+}
+
+// distinctValues returns the sorted distinct values of a single column result.
+func distinctValues(iter *gocql.Iter) ([]tagValue, error) {
+	seen := make(map[string]bool)
+	var names []string
+	cols := iter.Columns()
+	if len(cols) == 0 {
+		return nil, iter.Close()
+	}
+	for {
+		row := make(map[string]interface{})
+		if !iter.MapScan(row) {
+			break
+		}
+		v := row[cols[0].Name]
+		if v == nil {
+			continue
+		}
+		text := fmt.Sprintf("%v", toValue(v, cols[0].TypeInfo.Type().String()))
+		if !seen[text] {
+			seen[text] = true
+			names = append(names, text)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	res := make([]tagValue, len(names))
+	for i, name := range names {
+		res[i] = tagValue{Text: name}
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// aliasPlaceholder matches a {{column}} placeholder of an alias template.
+var aliasPlaceholder = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// aliasFieldName is the placeholder of the name of the value column.
+const aliasFieldName = "__field"
+
+// isValueField reports whether a field holds series values, numeric or bool.
+func isValueField(field *data.Field) bool {
+	return !isTimeField(field) && !isStringField(field)
+}
+
+// aliasValue resolves a placeholder for a value field: a label of the
+// series, the name of the value column, or else the first value of a
+// column of the frame, for series read from a single partition.
+func aliasValue(name string, frame *data.Frame, field *data.Field) string {
+	if name == aliasFieldName {
+		return field.Name
+	}
+	if v, ok := field.Labels[name]; ok {
+		return v
+	}
+	if idx := fieldIndex(frame, name); idx >= 0 && frame.Rows() > 0 {
+		if v, ok := frame.Fields[idx].ConcreteAt(0); ok {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return ""
+}
+
+// applyAlias sets the display name of the value fields of the frames from an
+// alias template, so series are named e.g. "node1 - read_latency" by
+// "{{node}} - {{__field}}" instead of by their field names and labels.
+func applyAlias(frames []*data.Frame, alias string) {
+	if alias == "" {
+		return
+	}
+	for _, frame := range frames {
+		for _, field := range frame.Fields {
+			if !isValueField(field) {
+				continue
+			}
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.DisplayName = aliasPlaceholder.ReplaceAllStringFunc(alias, func(m string) string {
+				return aliasValue(aliasPlaceholder.FindStringSubmatch(m)[1], frame, field)
+			})
+		}
+	}
+}
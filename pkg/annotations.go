@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// defaultAnnotationsRole is the lowest organization role allowed to write
+// annotations when annotationsRole is not set.
+const defaultAnnotationsRole = "Editor"
+
+// roleRanks orders the Grafana organization roles.
+var roleRanks = map[string]int{"Viewer": 1, "Editor": 2, "Admin": 3}
+
+// checkAnnotationsSettings validates the annotations write-back settings.
+func checkAnnotationsSettings(settings editModel) error {
+	if settings.AnnotationsTable != "" && !strings.Contains(settings.AnnotationsTable, ".") {
+		return fmt.Errorf("annotationsTable %q must be keyspace qualified (keyspace.table)", settings.AnnotationsTable)
+	}
+	if _, ok := roleRanks[settings.AnnotationsRole]; settings.AnnotationsRole != "" && !ok {
+		return fmt.Errorf("unknown annotationsRole %q, use Viewer, Editor or Admin", settings.AnnotationsRole)
+	}
+	return nil
+}
+
+// canWriteAnnotations reports whether the user who made a resource call has
+// at least the role required to write annotations.
+func (settings *instanceSettings) canWriteAnnotations(r *http.Request) bool {
+	role := settings.settings.AnnotationsRole
+	if role == "" {
+		role = defaultAnnotationsRole
+	}
+	user := httpadapter.UserFromContext(r.Context())
+	return user != nil && roleRanks[user.Role] >= roleRanks[role]
+}
+
+// annotation is an annotation created in Grafana, times are epoch milliseconds.
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID"`
+	PanelID      int64    `json:"panelId"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd"`
+	Text         string   `json:"text"`
+	Tags         []string `json:"tags"`
+}
+
+// annotationsStatement returns the INSERT of an annotation into the annotationsTable.
+func (settings *instanceSettings) annotationsStatement() (string, error) {
+	parts := strings.SplitN(settings.settings.AnnotationsTable, ".", 2)
+	if len(parts) != 2 {
+		return "", errors.New("annotations write-back is not enabled, configure annotationsTable")
+	}
+	keyspace := settings.resolveKeyspace(strings.TrimSpace(parts[0]))
+	table := settings.resolveTable(keyspace, strings.TrimSpace(parts[1]))
+	return fmt.Sprintf("INSERT INTO %s.%s (dashboard_uid, time, id, time_end, panel_id, text, tags, login) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		quoteIdentifier(keyspace), quoteIdentifier(table)), nil
+}
+
+// handleAnnotations serves /annotations, a POST persists an annotation into
+// the annotationsTable so the annotation history lives next to the data.
+func (td *SampleDatasource) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("annotations must be posted"))
+		return
+	}
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	stmt, err := instance.annotationsStatement()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if !instance.canWriteAnnotations(r) {
+		writeError(w, http.StatusForbidden, errors.New("the user role may not write annotations"))
+		return
+	}
+	var a annotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if a.Time == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("annotation time is required"))
+		return
+	}
+	if a.TimeEnd == 0 {
+		a.TimeEnd = a.Time
+	}
+	session, err := instance.getSession("")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	login := ""
+	if user := httpadapter.UserFromContext(r.Context()); user != nil {
+		login = user.Login
+	}
+	id := gocql.TimeUUID()
+	err = instance.newQuery(r.Context(), session, stmt, a.DashboardUID, time.Unix(0, a.Time*int64(time.Millisecond)), id,
+		time.Unix(0, a.TimeEnd*int64(time.Millisecond)), a.PanelID, a.Text, a.Tags, login).Exec()
+	if err != nil {
+		log.DefaultLogger.Warn("Failed writing annotation", "err", err)
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id.String()})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// pathParams splits the path after prefix into its elements.
+func pathParams(path string, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+// handleKeyspaces serves /keyspaces and /keyspaces/{keyspace}/tables.
+func (td *SampleDatasource) handleKeyspaces(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	params := pathParams(r.URL.Path, "/keyspaces")
+	switch {
+	case len(params) == 0:
+		keyspaces, err := instance.schemaKeyspaces()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, withHint(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNil(keyspaces))
+	case len(params) == 2 && params[1] == "tables":
+		tables, err := instance.schemaTables(params[0])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, withHint(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNil(tables))
+	default:
+		writeError(w, http.StatusNotFound, errors.New("use /keyspaces or /keyspaces/{keyspace}/tables"))
+	}
+}
+
+// handleTables serves /tables/{keyspace}/{table}/columns.
+func (td *SampleDatasource) handleTables(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/tables")
+	if len(params) != 3 || params[2] != "columns" {
+		writeError(w, http.StatusNotFound, errors.New("use /tables/{keyspace}/{table}/columns"))
+		return
+	}
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	columns, err := instance.schemaColumns(params[0], params[1])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	if columns == nil {
+		columns = []columnInfo{}
+	}
+	writeJSON(w, http.StatusOK, columns)
+}
+
+// nonNil makes empty lists encode as [] instead of null.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gocql/gocql"
+)
+
+// checkBlobFormat validates the blobFormat of a query: hex, base64, text
+// (the UTF-8 text, hex when it is not valid UTF-8) or length.
+func checkBlobFormat(format string) error {
+	switch format {
+	case "", "hex", "base64", "text", "length":
+		return nil
+	}
+	return fmt.Errorf("unknown blobFormat %q, use hex, base64, text or length", format)
+}
+
+// blobConverter returns the converter of a blob column for a blobFormat,
+// without a format blobs are returned as the constant text Blob.
+func blobConverter(info gocql.TypeInfo, format string) (columnConverter, bool) {
+	if info.Type() != gocql.TypeBlob || format == "" {
+		return columnConverter{}, false
+	}
+	typ := "text"
+	if format == "length" {
+		typ = "bigint"
+	}
+	return columnConverter{typ: typ, convert: func(val interface{}) interface{} {
+		b, ok := val.([]byte)
+		if !ok {
+			return nil
+		}
+		switch format {
+		case "base64":
+			return base64.StdEncoding.EncodeToString(b)
+		case "text":
+			if utf8.Valid(b) {
+				return string(b)
+			}
+		case "length":
+			return int64(len(b))
+		}
+		return "0x" + hex.EncodeToString(b)
+	}}, true
+}
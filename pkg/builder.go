@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// builderMode is the editorMode of queries created with the query builder.
+const builderMode = "builder"
+
+var identifierRe = regexp.MustCompile(`^(?:[a-zA-Z_][a-zA-Z0-9_]*|"(?:[^"]|"")+")$`)
+
+// builderQuery is the structured query model used in builder mode.
+type builderQuery struct {
+	Keyspace string   `json:"keyspace"`
+	Table    string   `json:"table"`
+	Columns  []string `json:"columns"`
+	// Functions are user defined functions and aggregates selected after the columns.
+	Functions []builderFunction `json:"functions"`
+	// TimeColumn is used as the time axis and filtered by the dashboard time range.
+	TimeColumn string `json:"timeColumn"`
+	// TimeUnit is the epoch unit (s, ms, us, ns) of a numeric TimeColumn,
+	// empty when the column is a timestamp.
+	TimeUnit       string `json:"timeUnit"`
+	Where          string `json:"where"`
+	Limit          int    `json:"limit"`
+	AllowFiltering bool   `json:"allowFiltering"`
+}
+
+func checkIdentifier(kind string, name string) error {
+	if !identifierRe.MatchString(name) {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// epochUnits maps the supported epoch units to their duration.
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// toEpoch converts t to an epoch number in the given unit.
+func toEpoch(t time.Time, unit string) int64 {
+	return t.UnixNano() / int64(epochUnits[unit])
+}
+
+// epochToTime converts a numeric value holding an epoch in the given unit to time.Time.
+func epochToTime(val interface{}, unit string) interface{} {
+	d := int64(epochUnits[unit])
+	var n int64
+	switch t := val.(type) {
+	case int64:
+		n = t
+	case int:
+		n = int64(t)
+	case int32:
+		n = int64(t)
+	case int16:
+		n = int64(t)
+	case int8:
+		n = int64(t)
+	case float64:
+		return time.Unix(0, int64(t*float64(d))).UTC()
+	case float32:
+		return time.Unix(0, int64(float64(t)*float64(d))).UTC()
+	case *big.Int:
+		n = t.Int64()
+	case time.Time:
+		return t
+	default:
+		return nil
+	}
+	return time.Unix(0, n*d).UTC()
+}
+
+// resolve replaces the identifiers of the query with their quoted CQL form,
+// using the schema to find the exact case of each name, so tables and
+// columns created with quoted mixed case names are queryable.
+func (b *builderQuery) resolve(names nameResolver) error {
+	if b.Keyspace == "" || b.Table == "" {
+		return errors.New("builder query requires a keyspace and a table")
+	}
+	if err := checkIdentifier("keyspace", b.Keyspace); err != nil {
+		return err
+	}
+	if err := checkIdentifier("table", b.Table); err != nil {
+		return err
+	}
+	keyspace := names.resolveKeyspace(b.Keyspace)
+	table := names.resolveTable(keyspace, b.Table)
+	b.Keyspace, b.Table = quoteIdentifier(keyspace), quoteIdentifier(table)
+	column := func(name string) string {
+		return quoteIdentifier(names.resolveColumn(keyspace, table, name))
+	}
+	for i, c := range b.Columns {
+		if err := checkIdentifier("column", c); err != nil {
+			return err
+		}
+		b.Columns[i] = column(c)
+	}
+	if b.TimeColumn != "" {
+		if err := checkIdentifier("time column", b.TimeColumn); err != nil {
+			return err
+		}
+		b.TimeColumn = column(b.TimeColumn)
+	}
+	for i := range b.Functions {
+		if err := b.Functions[i].resolve(names, keyspace, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build returns the CQL statement and its bound values for the time range.
+func (b *builderQuery) build(timeRange backend.TimeRange, names nameResolver) (string, []interface{}, error) {
+	if err := b.resolve(names); err != nil {
+		return "", nil, err
+	}
+	if _, ok := epochUnits[b.TimeUnit]; b.TimeUnit != "" && !ok {
+		return "", nil, fmt.Errorf("unsupported time unit %q, use one of s, ms, us or ns", b.TimeUnit)
+	}
+	columns := "*"
+	if len(b.Columns) > 0 || len(b.Functions) > 0 {
+		if b.TimeColumn != "" && !containsString(b.Columns, b.TimeColumn) {
+			b.Columns = append([]string{b.TimeColumn}, b.Columns...)
+		}
+		selected := append([]string{}, b.Columns...)
+		for _, f := range b.Functions {
+			selected = append(selected, f.expr)
+		}
+		columns = strings.Join(selected, ", ")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s FROM %s.%s", columns, b.Keyspace, b.Table)
+	var conditions []string
+	var args []interface{}
+	if b.Where != "" {
+		conditions = append(conditions, b.Where)
+	}
+	if b.TimeColumn != "" {
+		conditions = append(conditions, b.TimeColumn+" >= ?", b.TimeColumn+" <= ?")
+		if b.TimeUnit != "" {
+			args = append(args, toEpoch(timeRange.From, b.TimeUnit), toEpoch(timeRange.To, b.TimeUnit))
+		} else {
+			args = append(args, timeRange.From, timeRange.To)
+		}
+	}
+	if len(conditions) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(conditions, " AND "))
+	}
+	if b.Limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", b.Limit)
+	}
+	if b.AllowFiltering {
+		sb.WriteString(" ALLOW FILTERING")
+	}
+	return sb.String(), args, nil
+}
+
+// columnConverter overrides the frame type and value conversion of a result column.
+type columnConverter struct {
+	typ     string
+	convert func(interface{}) interface{}
+}
+
+// converters returns the column converters the builder query requires.
+func (b *builderQuery) converters() map[string]columnConverter {
+	res := make(map[string]columnConverter)
+	if b.TimeColumn != "" && b.TimeUnit != "" {
+		unit := b.TimeUnit
+		res[normalizeIdentifier(b.TimeColumn)] = columnConverter{
+			typ: "timestamp",
+			convert: func(val interface{}) interface{} {
+				return epochToTime(val, unit)
+			},
+		}
+	}
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
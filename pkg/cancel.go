@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// errQueryCancelled is the error of a query cancelled through /cancel.
+var errQueryCancelled = errors.New("the query was cancelled")
+
+// runningQuery is a query being run, which /cancel may abort.
+type runningQuery struct {
+	User      string    `json:"user"`
+	RefID     string    `json:"refId"`
+	Dashboard string    `json:"dashboard,omitempty"`
+	Started   time.Time `json:"started"`
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// runningQueries tracks the queries an instance is running, so a user can
+// stop a runaway query instead of waiting for it to time out, and the
+// resource calls it is serving, so its sessions are not released under them.
+type runningQueries struct {
+	mu      sync.Mutex
+	next    int64
+	queries map[int64]*runningQuery
+	calls   int
+}
+
+func newRunningQueries() *runningQueries {
+	return &runningQueries{queries: make(map[int64]*runningQuery)}
+}
+
+// start registers a query of a user and returns its context, cancelled by
+// /cancel, and the function to call when the query is done, which reports
+// whether it was cancelled.
+func (r *runningQueries) start(ctx context.Context, user string, q backend.DataQuery, dashboard string) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	rq := &runningQuery{User: user, RefID: q.RefID, Dashboard: dashboard, Started: time.Now(), cancel: cancel}
+	r.mu.Lock()
+	r.next++
+	id := r.next
+	r.queries[id] = rq
+	r.mu.Unlock()
+	return ctx, func() bool {
+		r.mu.Lock()
+		delete(r.queries, id)
+		cancelled := rq.cancelled
+		r.mu.Unlock()
+		cancel()
+		return cancelled
+	}
+}
+
+// startCall registers a resource call and returns the function to call
+// when it is done.
+func (r *runningQueries) startCall() func() {
+	r.mu.Lock()
+	r.calls++
+	r.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			r.calls--
+			r.mu.Unlock()
+		})
+	}
+}
+
+// idle reports whether no query and no resource call is running.
+func (r *runningQueries) idle() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queries) == 0 && r.calls == 0
+}
+
+// cancel aborts the running queries of a user with the refID, of the
+// dashboard when it is set, and returns how many were cancelled.
+func (r *runningQueries) cancel(user string, refID string, dashboard string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, rq := range r.queries {
+		if rq.User != user || rq.RefID != refID || (dashboard != "" && rq.Dashboard != dashboard) {
+			continue
+		}
+		rq.cancelled = true
+		rq.cancel()
+		n++
+	}
+	return n
+}
+
+// list returns the running queries of a user, of every user when user is
+// empty, oldest first.
+func (r *runningQueries) list(user string) []runningQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []runningQuery{}
+	for _, rq := range r.queries {
+		if user == "" || rq.User == user {
+			res = append(res, *rq)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Started.Before(res[j].Started) })
+	return res
+}
+
+// pluginUser returns the login of the user of a request, empty when there
+// is none (e.g. alerting).
+func pluginUser(user *backend.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Login
+}
+
+// cancelRequest is the body of a /cancel call.
+type cancelRequest struct {
+	RefID     string `json:"refId"`
+	Dashboard string `json:"dashboard"`
+	// User is the user whose query is cancelled, only admins may set it
+	User string `json:"user"`
+}
+
+// handleCancel serves /cancel: GET lists the running queries of the user
+// and POST cancels the running queries of the user with a refId. Requests
+// without a login are refused unless they come from an admin.
+func (td *SampleDatasource) handleCancel(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	user := pluginUser(httpadapter.UserFromContext(r.Context()))
+	// the queries of a request without a login (e.g. an anonymous viewer)
+	// can not be told apart from those of other users or of alerting
+	if user == "" && !isAdmin(r) {
+		writeError(w, http.StatusForbidden, errors.New("listing and cancelling running queries requires a signed in user"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if isAdmin(r) && r.URL.Query().Get("all") == "true" {
+			user = ""
+		}
+		writeJSON(w, http.StatusOK, instance.running.list(user))
+	case http.MethodPost:
+		var req cancelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefID == "" {
+			writeError(w, http.StatusBadRequest, errors.New(`the body must be {"refId": "..."}`))
+			return
+		}
+		if req.User != "" && req.User != user {
+			if !isAdmin(r) {
+				writeError(w, http.StatusForbidden, errors.New("only admins may cancel the queries of other users"))
+				return
+			}
+			user = req.User
+		}
+		n := instance.running.cancel(user, req.RefID, req.Dashboard)
+		if n == 0 {
+			writeError(w, http.StatusNotFound, errors.New("no running query with this refId"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"cancelled": n})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET to list or POST to cancel running queries"))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// cdcQueryType is the query type reading the change events of a table.
+const cdcQueryType = "cdc"
+
+// cdcLogSuffix is appended to a table name by Scylla to name its CDC log table.
+const cdcLogSuffix = "_scylla_cdc_log"
+
+// cdcTimeColumn is the timeuuid of a change event in the CDC log.
+const cdcTimeColumn = "cdc$time"
+
+// cdcQuery returns the CQL reading the CDC log of the query table over the
+// time range. The log is partitioned by stream and the time is a clustering
+// column, so the query filters a scan of the whole log instead of reading
+// each stream of system_distributed.cdc_streams_descriptions_v2.
+func (settings *instanceSettings) cdcQuery(qm queryModel, timeRange backend.TimeRange) (string, []interface{}, error) {
+	if qm.Keyspace == "" || qm.Table == "" {
+		return "", nil, errors.New("a cdc query requires a keyspace and a table")
+	}
+	if err := checkIdentifier("keyspace", qm.Keyspace); err != nil {
+		return "", nil, err
+	}
+	if err := checkIdentifier("table", qm.Table); err != nil {
+		return "", nil, err
+	}
+	keyspace := settings.resolveKeyspace(qm.Keyspace)
+	table := settings.resolveTable(keyspace, qm.Table)
+	tables, err := settings.schemaTables(keyspace)
+	if err != nil {
+		return "", nil, err
+	}
+	if !containsString(tables, table+cdcLogSuffix) {
+		return "", nil, fmt.Errorf("CDC is not enabled on %s.%s", keyspace, table)
+	}
+	stmt := fmt.Sprintf(`SELECT * FROM %s.%s WHERE "%s" >= minTimeuuid(?) AND "%s" <= maxTimeuuid(?) ALLOW FILTERING`,
+		quoteIdentifier(keyspace), quoteIdentifier(table+cdcLogSuffix), cdcTimeColumn, cdcTimeColumn)
+	return stmt, []interface{}{timeRange.From, timeRange.To}, nil
+}
+
+// cdcConverters converts the timeuuid of the change events to their time.
+func cdcConverters() map[string]columnConverter {
+	return map[string]columnConverter{
+		cdcTimeColumn: {
+			typ: "timestamp",
+			convert: func(val interface{}) interface{} {
+				if u, ok := val.(gocql.UUID); ok {
+					return u.Time()
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// sortCDCEvents orders the events of all the streams by time.
+func sortCDCEvents(frame *data.Frame) *data.Frame {
+	for i, f := range frame.Fields {
+		if f.Name == cdcTimeColumn {
+			return sortByTime(frame, i)
+		}
+	}
+	return frame
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// maxProtoVersion is the highest CQL protocol version the driver supports.
+const maxProtoVersion = 4
+
+// maxNumConns bounds the connections per host a datasource may open.
+const maxNumConns = 64
+
+// maxPageSize bounds the rows fetched per page, and so the memory a page holds.
+const maxPageSize = 100000
+
+// defaultMaxConcurrentQueries is the number of queries of a request run at
+// once when maxConcurrentQueries is not set.
+const defaultMaxConcurrentQueries = 8
+
+// maxConcurrentQueriesLimit bounds the maxConcurrentQueries setting.
+const maxConcurrentQueriesLimit = 64
+
+// defaultSpeculativeDelay is the delay before a speculative attempt when speculativeDelay is not set.
+const defaultSpeculativeDelay = 100 * time.Millisecond
+
+// clusterOptions are the parsed connection settings of an instance.
+type clusterOptions struct {
+	consistency    gocql.Consistency
+	timeout        time.Duration
+	connectTimeout time.Duration
+	protoVersion   int
+	compressor     gocql.Compressor
+	numConns       int
+	pageSize       int
+	// latencyProbeInterval is how often the contact point latencies are measured again
+	latencyProbeInterval time.Duration
+	retryPolicy          gocql.RetryPolicy
+	speculative          gocql.SpeculativeExecutionPolicy
+	// idleTimeout is how long the instance is unused before its sessions and caches are released
+	idleTimeout time.Duration
+	// memoryBudget is the memory in bytes the caches and sessions of the instance may hold
+	memoryBudget int64
+}
+
+// parseClusterOptions validates and parses the connection settings, it
+// returns all the invalid settings as settingsErrors.
+func parseClusterOptions(settings editModel) (clusterOptions, error) {
+	var options clusterOptions
+	var errs settingsErrors
+	var err error
+	if options.consistency, err = parseConsistency(settings.Consistency); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if options.timeout, err = parseDuration("timeout", settings.Timeout, 0); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if options.connectTimeout, err = parseDuration("connectTimeout", settings.ConnectTimeout, 0); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.ProtoVersion < 0 || settings.ProtoVersion > maxProtoVersion {
+		errs = append(errs, fmt.Sprintf("invalid protoVersion %d, supported versions are 1 to %d", settings.ProtoVersion, maxProtoVersion))
+	}
+	options.protoVersion = settings.ProtoVersion
+	if options.compressor, err = parseCompression(settings.Compression); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.NumConns < 0 || settings.NumConns > maxNumConns {
+		errs = append(errs, fmt.Sprintf("invalid numConns %d, use 1 to %d connections per host", settings.NumConns, maxNumConns))
+	}
+	options.numConns = settings.NumConns
+	if settings.PageSize < 0 || settings.PageSize > maxPageSize {
+		errs = append(errs, fmt.Sprintf("invalid pageSize %d, use 1 to %d rows", settings.PageSize, maxPageSize))
+	}
+	options.pageSize = settings.PageSize
+	if options.latencyProbeInterval, err = parseDuration("latencyProbeInterval", settings.LatencyProbeInterval, defaultLatencyProbeInterval); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.MaxRows < 0 {
+		errs = append(errs, fmt.Sprintf("invalid maxRows %d", settings.MaxRows))
+	}
+	if settings.MaxConcurrentQueries < 0 || settings.MaxConcurrentQueries > maxConcurrentQueriesLimit {
+		errs = append(errs, fmt.Sprintf("invalid maxConcurrentQueries %d, use 1 to %d", settings.MaxConcurrentQueries, maxConcurrentQueriesLimit))
+	}
+	if settings.MaxSessions < 0 || settings.MaxSessions > maxSessionsLimit {
+		errs = append(errs, fmt.Sprintf("invalid maxSessions %d, use 1 to %d", settings.MaxSessions, maxSessionsLimit))
+	}
+	if options.idleTimeout, err = parseDuration("idleTimeout", settings.IdleTimeout, defaultIdleTimeout); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.MemoryBudgetMB < 0 || settings.MemoryBudgetMB > maxMemoryBudgetMB {
+		errs = append(errs, fmt.Sprintf("invalid memoryBudgetMB %d, use 1 to %d", settings.MemoryBudgetMB, maxMemoryBudgetMB))
+	}
+	options.memoryBudget = int64(defaultMemoryBudgetMB) << 20
+	if settings.MemoryBudgetMB > 0 {
+		options.memoryBudget = int64(settings.MemoryBudgetMB) << 20
+	}
+	if options.retryPolicy, err = parseRetryPolicy(settings); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.SpeculativeAttempts < 0 {
+		errs = append(errs, fmt.Sprintf("invalid speculativeAttempts %d", settings.SpeculativeAttempts))
+	}
+	if settings.SpeculativeAttempts > 0 {
+		delay, err := parseDuration("speculativeDelay", settings.SpeculativeDelay, defaultSpeculativeDelay)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		options.speculative = &gocql.SimpleSpeculativeExecution{NumAttempts: settings.SpeculativeAttempts, TimeoutDelay: delay}
+	}
+	if len(errs) > 0 {
+		return options, errs
+	}
+	return options, nil
+}
+
+// newCluster creates a cluster configuration for the given hosts with all
+// the connection options of the instance applied.
+func (settings *instanceSettings) newCluster(hosts ...string) *gocql.ClusterConfig {
+	cluster := gocql.NewCluster(hosts...)
+	if settings.authenticator != nil {
+		cluster.Authenticator = *settings.authenticator
+	}
+	cluster.Consistency = settings.options.consistency
+	if settings.options.timeout > 0 {
+		cluster.Timeout = settings.options.timeout
+	}
+	if settings.options.connectTimeout > 0 {
+		cluster.ConnectTimeout = settings.options.connectTimeout
+	}
+	// writes are never retried, newQuery sets the retry policy of reads
+	cluster.RetryPolicy = nil
+	if settings.options.numConns > 0 {
+		cluster.NumConns = settings.options.numConns
+	}
+	if settings.options.pageSize > 0 {
+		cluster.PageSize = settings.options.pageSize
+	}
+	if settings.options.compressor != nil {
+		cluster.Compressor = settings.options.compressor
+	}
+	if settings.options.protoVersion > 0 {
+		// skip the protocol autodetection
+		cluster.ProtoVersion = settings.options.protoVersion
+	}
+	if settings.tlsConfig != nil {
+		// the driver sets InsecureSkipVerify from EnableHostVerification
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 settings.tlsConfig.Clone(),
+			EnableHostVerification: !settings.tlsConfig.InsecureSkipVerify,
+		}
+	}
+	return cluster
+}
+
+// maxConcurrentQueries returns how many queries of a request may run at once.
+func (settings *instanceSettings) maxConcurrentQueries() int {
+	if n := settings.settings.MaxConcurrentQueries; n > 0 {
+		return n
+	}
+	return defaultMaxConcurrentQueries
+}
+
+// maxRows returns the number of rows a query may read, the query limit can
+// only lower the datasource limit. Zero means no limit.
+func (settings *instanceSettings) maxRows(queryLimit int) int {
+	limit := settings.settings.MaxRows
+	if queryLimit > 0 && (limit == 0 || queryLimit < limit) {
+		limit = queryLimit
+	}
+	return limit
+}
+
+// hostSelectionPolicy returns a new host selection policy for a session,
+// policies hold per session state and can not be shared between sessions.
+func (settings *instanceSettings) hostSelectionPolicy() gocql.HostSelectionPolicy {
+	policy := gocql.RoundRobinHostPolicy()
+	if dc := settings.settings.LocalDatacenter; dc != "" {
+		// keep queries in the local DC, remote hosts are only used when no local host is up
+		policy = gocql.DCAwareRoundRobinPolicy(dc)
+	}
+	if !settings.settings.DisableTokenAware {
+		// send single partition queries directly to a replica
+		policy = gocql.TokenAwareHostPolicy(policy)
+	}
+	return policy
+}
+
+// parseConsistency parses a consistency level name (ONE, LOCAL_QUORUM, ...),
+// an empty name returns the driver default.
+func parseConsistency(name string) (gocql.Consistency, error) {
+	if name == "" {
+		return gocql.Quorum, nil
+	}
+	consistency, err := gocql.ParseConsistencyWrapper(strings.ToUpper(strings.TrimSpace(name)))
+	if err != nil {
+		return gocql.Quorum, fmt.Errorf("invalid consistency level %q", name)
+	}
+	return consistency, nil
+}
+
+// parseDuration parses a duration setting (e.g. "500ms", "10s"), an empty
+// value returns def.
+func parseDuration(name string, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return def, fmt.Errorf("invalid %s duration %q", name, value)
+	}
+	return d, nil
+}
+
+// parseCompression returns the compressor of a compression setting.
+func parseCompression(name string) (gocql.Compressor, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return nil, nil
+	case "snappy":
+		return gocql.SnappyCompressor{}, nil
+	case "lz4":
+		return nil, fmt.Errorf("lz4 compression is not available in this build, use snappy")
+	}
+	return nil, fmt.Errorf("unsupported compression %q, use none or snappy", name)
+}
+
+// defaultRetryCount is used when a retry policy is set without retryCount.
+const defaultRetryCount = 3
+
+// parseRetryPolicy returns the retry policy of the settings, nil disables retries.
+func parseRetryPolicy(settings editModel) (gocql.RetryPolicy, error) {
+	count := settings.RetryCount
+	if count < 0 {
+		return nil, fmt.Errorf("invalid retryCount %d", count)
+	}
+	if count == 0 {
+		count = defaultRetryCount
+	}
+	switch strings.ToLower(settings.RetryPolicy) {
+	case "", "none":
+		return nil, nil
+	case "simple":
+		return &gocql.SimpleRetryPolicy{NumRetries: count}, nil
+	case "exponential":
+		min, err := parseDuration("retryMinInterval", settings.RetryMinInterval, 100*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		max, err := parseDuration("retryMaxInterval", settings.RetryMaxInterval, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if min > max {
+			return nil, fmt.Errorf("retryMinInterval %s is larger than retryMaxInterval %s", min, max)
+		}
+		return &gocql.ExponentialBackoffRetryPolicy{NumRetries: count, Min: min, Max: max}, nil
+	}
+	return nil, fmt.Errorf("unsupported retryPolicy %q, use none, simple or exponential", settings.RetryPolicy)
+}
+
+// isRead reports whether every statement of a query is a SELECT, which is
+// safe to retry and to execute speculatively. Comments and parentheses
+// before the keyword are skipped, a query that can not be tokenized is not
+// a read.
+func isRead(stmt string) bool {
+	tokens, err := cqlTokens(stmt)
+	if err != nil {
+		return false
+	}
+	read, first := false, true
+	for _, t := range tokens {
+		switch {
+		case t == ";":
+			first = true
+		case t == "(" || !first:
+		case strings.EqualFold(t, "select"):
+			read, first = true, false
+		default:
+			return false
+		}
+	}
+	return read
+}
+
+// newQuery creates a query with the per query options of the instance
+// applied, the query is cancelled when ctx is done.
+func (settings *instanceSettings) newQuery(ctx context.Context, session *gocql.Session, stmt string, values ...interface{}) *gocql.Query {
+	q := session.Query(stmt, values...).WithContext(ctx)
+	if !isRead(stmt) {
+		// a write may have been applied before it failed, it is neither retried nor raced
+		return q
+	}
+	if settings.options.retryPolicy != nil {
+		q = q.RetryPolicy(settings.options.retryPolicy)
+	}
+	if settings.options.speculative != nil {
+		// a slow replica is raced by another one, only idempotent queries may be executed speculatively
+		q = q.Idempotent(true).SetSpeculativeExecutionPolicy(settings.options.speculative)
+	}
+	return q
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// coerceFrame returns a copy of the frame with every numeric field converted
+// to a nullable float64 field and every time field to a time field without
+// nulls, so Grafana expressions never mix numeric types. Rows with a null
+// time are dropped.
+func coerceFrame(frame *data.Frame) *data.Frame {
+	var rows []int
+	for i := 0; i < frame.Rows(); i++ {
+		null := false
+		for _, f := range frame.Fields {
+			if f.Type() == data.FieldTypeNullableTime {
+				if _, ok := f.ConcreteAt(i); !ok {
+					null = true
+					break
+				}
+			}
+		}
+		if !null {
+			rows = append(rows, i)
+		}
+	}
+	res := frame.EmptyCopy()
+	res.Meta = frame.Meta
+	for i, field := range frame.Fields {
+		var f *data.Field
+		switch {
+		case field.Type().Time():
+			times := make([]time.Time, len(rows))
+			for j, row := range rows {
+				times[j], _ = timeAt(field, row)
+			}
+			f = data.NewField(field.Name, field.Labels, times)
+		case field.Type().Numeric():
+			values := make([]*float64, len(rows))
+			for j, row := range rows {
+				if _, ok := field.ConcreteAt(row); !ok {
+					continue
+				}
+				if v, err := field.FloatAt(row); err == nil {
+					values[j] = &v
+				}
+			}
+			f = data.NewField(field.Name, field.Labels, values)
+		default:
+			f = data.NewFieldFromFieldType(field.Type(), len(rows))
+			f.Name, f.Labels = field.Name, field.Labels
+			for j, row := range rows {
+				f.Set(j, field.At(row))
+			}
+		}
+		f.Config = field.Config
+		res.Fields[i] = f
+	}
+	return res
+}
+
+// coerceFrames coerces the fields of the frames of a query run with coerceNumbers.
+func coerceFrames(frames []*data.Frame) {
+	for i, frame := range frames {
+		frames[i] = coerceFrame(frame)
+	}
+}
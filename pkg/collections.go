@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// mapKeyLabel is the label of the fields of an exploded map column holding the map key.
+const mapKeyLabel = "key"
+
+// checkCollectionFormat validates the collectionFormat of a query: json, the
+// default, or join.
+func checkCollectionFormat(format string) error {
+	switch format {
+	case "", "json", "join":
+		return nil
+	}
+	return fmt.Errorf("unknown collectionFormat %q, use json or join", format)
+}
+
+// collectionText returns the text of a collection element of type typ.
+func collectionText(v interface{}, typ string) string {
+	switch t := toValue(v, typ).(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// collectionConverter returns the converter of a list or set column for
+// the join collectionFormat: the text of the elements, comma separated.
+func collectionConverter(info gocql.TypeInfo, format string) (columnConverter, bool) {
+	coll, ok := info.(gocql.CollectionType)
+	if !ok || format != "join" || (coll.Type() != gocql.TypeList && coll.Type() != gocql.TypeSet) {
+		return columnConverter{}, false
+	}
+	elem := coll.Elem.Type().String()
+	return columnConverter{typ: "text", convert: func(val interface{}) interface{} {
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil
+		}
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			elems[i] = collectionText(rv.Index(i).Interface(), elem)
+		}
+		return strings.Join(elems, ",")
+	}}, true
+}
+
+// rawColumns keeps the scanned values of the map and vector columns to
+// explode, of the user defined type and tuple columns and of the timeuuid
+// columns to keep of a result, which are replaced by a field per map key,
+// vector element, type member or tuple element, or followed by their UUIDs,
+// once all the rows are read.
+type rawColumns struct {
+	columns []int
+	types   []gocql.TypeInfo
+	// rows holds the values of each column, nil for NULL
+	rows [][]interface{}
+}
+
+// newRawColumns returns the columns of a result to expand, nil when there
+// is none. Map columns are only expanded with explodeMaps and vectors with
+// explodeVectors, tuples are kept as JSON text with tuplesAsJSON and
+// timeuuids are only kept with the both timeuuidFormat.
+func newRawColumns(cols []gocql.ColumnInfo, qm *queryModel) *rawColumns {
+	var r rawColumns
+	for i, c := range cols {
+		switch c.TypeInfo.Type() {
+		case gocql.TypeMap:
+			if !qm.ExplodeMaps {
+				continue
+			}
+		case gocql.TypeTuple:
+			if qm.TuplesAsJSON {
+				continue
+			}
+		case gocql.TypeTimeUUID:
+			if qm.TimeUUIDFormat != "both" {
+				continue
+			}
+		case gocql.TypeCustom:
+			if _, ok := parseVectorType(c.TypeInfo); !ok || !qm.ExplodeVectors {
+				continue
+			}
+		case gocql.TypeUDT:
+		default:
+			continue
+		}
+		r.columns = append(r.columns, i)
+		r.types = append(r.types, c.TypeInfo)
+	}
+	if len(r.columns) == 0 {
+		return nil
+	}
+	r.rows = make([][]interface{}, len(r.columns))
+	return &r
+}
+
+// reset drops the recorded values, once their rows are expanded.
+func (r *rawColumns) reset() {
+	for j := range r.rows {
+		r.rows[j] = nil
+	}
+}
+
+// add records the values of the row scanned into scratch.
+func (r *rawColumns) add(scratch *rowScratch) {
+	for j, i := range r.columns {
+		r.rows[j] = append(r.rows[j], scratch.value(i))
+	}
+}
+
+// expand replaces the field of each kept column by the fields of its map
+// keys, vector elements, type members or tuple elements, or by its time and
+// UUID fields.
+func (r *rawColumns) expand(frame *data.Frame) {
+	expanded := make(map[int][]*data.Field, len(r.columns))
+	for j, i := range r.columns {
+		if i >= len(frame.Fields) || len(r.rows[j]) != frame.Rows() {
+			continue
+		}
+		switch info := r.types[j].(type) {
+		case gocql.CollectionType:
+			expanded[i] = mapFields(frame.Fields[i].Name, info, r.rows[j])
+		case gocql.UDTTypeInfo:
+			expanded[i] = udtFields(frame.Fields[i].Name, info, r.rows[j])
+		case gocql.TupleTypeInfo:
+			expanded[i] = tupleFields(frame.Fields[i].Name, info, r.rows[j])
+		default:
+			if vector, ok := parseVectorType(info); ok {
+				expanded[i] = vectorFields(frame.Fields[i].Name, vector, r.rows[j])
+			} else if info.Type() == gocql.TypeTimeUUID {
+				expanded[i] = timeUUIDFields(frame.Fields[i], r.rows[j])
+			}
+		}
+	}
+	fields := make([]*data.Field, 0, len(frame.Fields))
+	for i, f := range frame.Fields {
+		if replaced, ok := expanded[i]; ok {
+			fields = append(fields, replaced...)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	frame.Fields = fields
+}
+
+// isTextType reports whether the values of typ are returned in text fields.
+func isTextType(typ string) bool {
+	_, ok := getTypeArray(typ).([]*string)
+	return ok
+}
+
+// fieldValue returns the field value of a scanned value of typ, text when
+// the type has no field type of its own.
+func fieldValue(v interface{}, typ string, text bool) interface{} {
+	value := toValue(v, typ)
+	if value != nil && text {
+		value = collectionText(v, typ)
+	}
+	return value
+}
+
+// mapFields returns a field per key of the maps of a column, labeled with
+// the key and typed as the map values, sorted by key. Rows without the key
+// are null.
+func mapFields(name string, info gocql.CollectionType, rows []interface{}) []*data.Field {
+	keyType, valueType := info.Key.Type().String(), info.Elem.Type().String()
+	text := isTextType(valueType)
+	byKey := map[string]*data.Field{}
+	var keys []string
+	for row, v := range rows {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map {
+			continue
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			value := fieldValue(iter.Value().Interface(), valueType, text)
+			if value == nil {
+				continue
+			}
+			key := collectionText(iter.Key().Interface(), keyType)
+			field, ok := byKey[key]
+			if !ok {
+				field = data.NewField(name, data.Labels{mapKeyLabel: key}, getTypeArray(valueType))
+				field.Extend(len(rows))
+				byKey[key] = field
+				keys = append(keys, key)
+			}
+			field.SetConcrete(row, value)
+		}
+	}
+	sort.Strings(keys)
+	fields := make([]*data.Field, len(keys))
+	for k, key := range keys {
+		fields[k] = byKey[key]
+	}
+	return fields
+}
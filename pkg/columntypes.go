@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// columnCasts are the field types columnTypes may force a column to.
+var columnCasts = map[string]bool{"number": true, "time": true, "string": true, "boolean": true}
+
+// checkColumnTypes validates the columnTypes of a query.
+func checkColumnTypes(types map[string]string) error {
+	for column, cast := range types {
+		if !columnCasts[cast] {
+			return fmt.Errorf("unknown column type %q of %s, use number, time, string or boolean", cast, column)
+		}
+	}
+	return nil
+}
+
+// castConverter returns the converter forcing a column of type typ to a
+// cast of columnTypes. Times are parsed as a time column, in unit for
+// numbers. Values that can not be converted are null.
+func castConverter(name string, typ string, cast string, unit string) (columnConverter, bool, error) {
+	switch cast {
+	case "time":
+		return timeConverter(name, typ, unit)
+	case "number":
+		return columnConverter{typ: "double", convert: func(val interface{}) interface{} {
+			return castNumber(val, typ)
+		}}, true, nil
+	case "boolean":
+		return columnConverter{typ: "boolean", convert: func(val interface{}) interface{} {
+			switch t := castNumber(val, typ).(type) {
+			case float64:
+				return t != 0
+			}
+			if s, ok := val.(string); ok {
+				if b, err := strconv.ParseBool(s); err == nil {
+					return b
+				}
+			}
+			return nil
+		}}, true, nil
+	}
+	return columnConverter{typ: "text", convert: func(val interface{}) interface{} {
+		return collectionText(val, typ)
+	}}, true, nil
+}
+
+// castNumber returns the float64 of a scanned value: numbers, text holding
+// a number, booleans as 0 or 1 and times as epoch milliseconds.
+func castNumber(val interface{}, typ string) interface{} {
+	switch t := val.(type) {
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f
+		}
+		return nil
+	case bool:
+		if t {
+			return 1.0
+		}
+		return 0.0
+	case time.Time:
+		return float64(t.UnixNano()) / float64(time.Millisecond)
+	}
+	switch t := toValue(val, typ).(type) {
+	case int64:
+		return float64(t)
+	case int16:
+		return float64(t)
+	case int8:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case float64:
+		return t
+	}
+	return nil
+}
+
+// missingColumnTypes returns the notices of the columnTypes that are not
+// fields of the frame.
+func missingColumnTypes(frame *data.Frame, types map[string]string) []data.Notice {
+	var missing []string
+	for column := range types {
+		if fieldIndex(frame, column) < 0 {
+			missing = append(missing, column)
+		}
+	}
+	sort.Strings(missing)
+	notices := make([]data.Notice, len(missing))
+	for i, column := range missing {
+		notices[i] = data.Notice{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("columnTypes column %q is not in the result", column)}
+	}
+	return notices
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// countQueryType is the query type estimating the number of rows of a table.
+const countQueryType = "count"
+
+// defaultCountRanges is the number of token ranges the ring is split into.
+const defaultCountRanges = 256
+
+// maxCountRanges bounds the ranges query setting.
+const maxCountRanges = 65536
+
+// defaultSampleRanges is the number of token ranges counted when sampleRanges is not set.
+const defaultSampleRanges = 32
+
+// defaultRangeTimeout bounds the COUNT of a single token range.
+const defaultRangeTimeout = 2 * time.Second
+
+// tokenRange is a [start, end] range of the Murmur3 token ring.
+type tokenRange struct {
+	start int64
+	end   int64
+}
+
+// splitTokenRing splits the token ring into n contiguous ranges of equal width.
+func splitTokenRing(n int) []tokenRange {
+	step := math.MaxUint64 / uint64(n)
+	ranges := make([]tokenRange, n)
+	for i := range ranges {
+		// computed in uint64 so the ranges wrap from the lowest token
+		ranges[i].start = int64(uint64(1)<<63 + uint64(i)*step)
+		if i == n-1 {
+			ranges[i].end = math.MaxInt64
+		} else {
+			ranges[i].end = int64(uint64(1)<<63+uint64(i+1)*step) - 1
+		}
+	}
+	return ranges
+}
+
+// sampleTokenRanges returns n ranges evenly spread over the ring.
+func sampleTokenRanges(ranges []tokenRange, n int) []tokenRange {
+	if n >= len(ranges) {
+		return ranges
+	}
+	res := make([]tokenRange, n)
+	for i := range res {
+		res[i] = ranges[i*len(ranges)/n]
+	}
+	return res
+}
+
+// rowCountEstimate is an estimate of the rows of a table extrapolated from
+// the counted token ranges. StdErr is the standard error of the estimate,
+// Low and High its 95% confidence interval.
+type rowCountEstimate struct {
+	Estimate int64
+	Low      int64
+	High     int64
+	StdErr   float64
+	Ranges   int
+	Counted  int
+	Failed   int
+	Exact    bool
+}
+
+// estimateRows extrapolates the counts of a sample of the total token ranges
+// to the whole ring, with a finite population correction for the ranges counted.
+func estimateRows(counts []int64, total int) rowCountEstimate {
+	res := rowCountEstimate{Ranges: total, Counted: len(counts)}
+	if len(counts) == 0 {
+		return res
+	}
+	var sum float64
+	for _, c := range counts {
+		sum += float64(c)
+	}
+	n := float64(len(counts))
+	mean := sum / n
+	res.Estimate = int64(math.Round(mean * float64(total)))
+	if len(counts) == total {
+		res.Exact = true
+		res.Low, res.High = res.Estimate, res.Estimate
+		return res
+	}
+	if len(counts) > 1 {
+		var ss float64
+		for _, c := range counts {
+			ss += (float64(c) - mean) * (float64(c) - mean)
+		}
+		sd := math.Sqrt(ss / (n - 1))
+		res.StdErr = float64(total) * sd / math.Sqrt(n) * math.Sqrt(1-n/float64(total))
+	}
+	margin := 1.96 * res.StdErr
+	res.Low = int64(math.Max(sum, math.Round(float64(res.Estimate)-margin)))
+	res.High = int64(math.Round(float64(res.Estimate) + margin))
+	return res
+}
+
+// countQuery returns the COUNT of a token range of the query table.
+func (settings *instanceSettings) countQuery(qm queryModel, timeout time.Duration) (string, error) {
+	if qm.Keyspace == "" || qm.Table == "" {
+		return "", errors.New("a count query requires a keyspace and a table")
+	}
+	if err := checkIdentifier("keyspace", qm.Keyspace); err != nil {
+		return "", err
+	}
+	if err := checkIdentifier("table", qm.Table); err != nil {
+		return "", err
+	}
+	keyspace := settings.resolveKeyspace(qm.Keyspace)
+	table := settings.resolveTable(keyspace, qm.Table)
+	columns, err := settings.schemaColumns(keyspace, table)
+	if err != nil {
+		return "", err
+	}
+	var partitionKey []string
+	for _, c := range columns {
+		if c.Kind == "partition_key" {
+			partitionKey = append(partitionKey, quoteIdentifier(c.Name))
+		}
+	}
+	if len(partitionKey) == 0 {
+		return "", fmt.Errorf("table %s.%s not found", keyspace, table)
+	}
+	token := "token(" + strings.Join(partitionKey, ", ") + ")"
+	stmt := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s WHERE %s >= ? AND %s <= ?",
+		quoteIdentifier(keyspace), quoteIdentifier(table), token, token)
+	if qm.Filter != "" {
+		stmt += " AND " + qm.Filter + " ALLOW FILTERING"
+	}
+	stmt += fmt.Sprintf(" USING TIMEOUT %dms", timeout.Milliseconds())
+	return stmt, nil
+}
+
+// approximateCount counts a sample of the token ranges of a table in
+// parallel, each bounded by a timeout, and extrapolates the table row count.
+// Ranges that fail or time out are left out of the sample.
+func (settings *instanceSettings) approximateCount(ctx context.Context, stmt string, ranges int, sample int, timeout time.Duration) (rowCountEstimate, error) {
+	session, err := settings.getSession("")
+	if err != nil {
+		return rowCountEstimate{}, err
+	}
+	sampled := sampleTokenRanges(splitTokenRing(ranges), sample)
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		counts  []int64
+		lastErr error
+	)
+	slots := make(chan struct{}, settings.maxConcurrentQueries())
+	for _, r := range sampled {
+		wg.Add(1)
+		go func(r tokenRange) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			rctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			var count int64
+			err := settings.newQuery(rctx, session, stmt, r.start, r.end).Scan(&count)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			counts = append(counts, count)
+		}(r)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return rowCountEstimate{}, err
+	}
+	if len(counts) == 0 {
+		return rowCountEstimate{}, fmt.Errorf("no token range could be counted: %w", lastErr)
+	}
+	res := estimateRows(counts, ranges)
+	res.Failed = len(sampled) - len(counts)
+	return res, nil
+}
+
+// countFrame returns the estimate as a single row frame.
+func countFrame(res rowCountEstimate) *data.Frame {
+	return data.NewFrame("count",
+		data.NewField("estimate", nil, []int64{res.Estimate}),
+		data.NewField("low", nil, []int64{res.Low}),
+		data.NewField("high", nil, []int64{res.High}),
+		data.NewField("stderr", nil, []float64{res.StdErr}),
+		data.NewField("ranges", nil, []int64{int64(res.Ranges)}),
+		data.NewField("counted", nil, []int64{int64(res.Counted)}),
+		data.NewField("failed", nil, []int64{int64(res.Failed)}),
+		data.NewField("exact", nil, []bool{res.Exact}),
+	)
+}
+
+// countResponse runs a count query.
+func (settings *instanceSettings) countResponse(ctx context.Context, qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+	ranges, sample := qm.Ranges, qm.SampleRanges
+	if ranges == 0 {
+		ranges = defaultCountRanges
+	}
+	if ranges < 0 || ranges > maxCountRanges {
+		response.Error = fmt.Errorf("ranges must be between 1 and %d", maxCountRanges)
+		return response
+	}
+	if sample == 0 {
+		sample = defaultSampleRanges
+	}
+	if sample < 0 {
+		response.Error = fmt.Errorf("invalid sampleRanges %d", sample)
+		return response
+	}
+	timeout, err := parseDuration("rangeTimeout", qm.RangeTimeout, defaultRangeTimeout)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+	stmt, err := settings.countQuery(qm, timeout)
+	if err != nil {
+		log.DefaultLogger.Info("Failed building count query", "err", err)
+		response.Error = withHint(err)
+		return response
+	}
+	if err := settings.checkQuery(stmt); err != nil {
+		log.DefaultLogger.Info("Query rejected", "err", err)
+		response.Error = err
+		return response
+	}
+	res, err := settings.approximateCount(ctx, stmt, ranges, sample, timeout)
+	if err != nil {
+		log.DefaultLogger.Info("Failed counting rows", "err", err)
+		response.Error = withHint(err)
+		return response
+	}
+	frame := countFrame(res)
+	frame.Meta = &data.FrameMeta{ExecutedQueryString: stmt}
+	if res.Failed > 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d of %d sampled token ranges failed or timed out and were left out of the estimate", res.Failed, res.Failed+res.Counted),
+		})
+	}
+	response.Frames = append(response.Frames, frame)
+	return response
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRecentErrors is the number of errors kept per instance for /debug/state.
+const maxRecentErrors = 20
+
+type recentError struct {
+	Time  time.Time `json:"time"`
+	RefID string    `json:"refId,omitempty"`
+	Error string    `json:"error"`
+}
+
+// errorLog is a bounded, thread safe, list of the latest errors of an instance.
+type errorLog struct {
+	mu      sync.Mutex
+	size    int
+	entries []recentError
+}
+
+func newErrorLog(size int) *errorLog {
+	return &errorLog{size: size}
+}
+
+func (l *errorLog) add(refID string, err error) {
+	if l == nil || err == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, recentError{Time: time.Now(), RefID: refID, Error: err.Error()})
+	if len(l.entries) > l.size {
+		l.entries = l.entries[len(l.entries)-l.size:]
+	}
+}
+
+func (l *errorLog) list() []recentError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]recentError, len(l.entries))
+	copy(res, l.entries)
+	return res
+}
+
+// debugState is the instance state returned by /debug/state.
+type debugState struct {
+	Settings editModel `json:"settings"`
+	HasUser  bool      `json:"hasUser"`
+	// HasMonitorUser is set when the health checks have their own credential
+	HasMonitorUser bool          `json:"hasMonitorUser"`
+	HasCluster     bool          `json:"hasCluster"`
+	Sessions       []string      `json:"sessions"`
+	RecentErrors   []recentError `json:"recentErrors"`
+	SchemaCache    int           `json:"schemaCacheEntries"`
+	// ContactPoints are the last measured contact point latencies, fastest first
+	ContactPoints []contactPointLatency `json:"contactPoints,omitempty"`
+	ResultCache   *resultCacheStats     `json:"resultCache,omitempty"`
+	RateLimits    []dashboardStats      `json:"rateLimits,omitempty"`
+	// RunningQueries are the queries being run, of every user
+	RunningQueries []runningQuery `json:"runningQueries"`
+	// Memory is the estimated memory held by the instance
+	Memory memoryUsage `json:"memory"`
+}
+
+// debugState returns a snapshot of the instance state. Credentials are never
+// included, only whether they were configured.
+func (settings *instanceSettings) debugState() debugState {
+	settings.mu.Lock()
+	sessions := make([]string, 0, len(settings.sessions))
+	for host := range settings.sessions {
+		sessions = append(sessions, host)
+	}
+	hasCluster := settings.cluster != nil
+	settings.mu.Unlock()
+	sort.Strings(sessions)
+	return debugState{
+		Settings:       settings.settings,
+		HasUser:        settings.authenticator != nil,
+		HasMonitorUser: settings.monitorAuthenticator != nil,
+		HasCluster:     hasCluster,
+		Sessions:       sessions,
+		RecentErrors:   settings.errors.list(),
+		SchemaCache:    settings.schema.size(),
+		ContactPoints:  settings.contactPoints.latencies(),
+		ResultCache:    settings.results.stats(),
+		RateLimits:     settings.limiter.stats(),
+		RunningQueries: settings.running.list(""),
+		Memory:         settings.memoryUsage(),
+	}
+}
+
+// handleDebugState dumps the instance internal state, it is only available to admins.
+func (td *SampleDatasource) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeError(w, http.StatusForbidden, errors.New("debug state is only available to admins"))
+		return
+	}
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, instance.debugState())
+}
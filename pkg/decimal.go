@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"gopkg.in/inf.v0"
+)
+
+// decimalFloatSuffix is the suffix of the float fields returned along with
+// the exact text of varint and decimal columns by the both decimalFormat.
+const decimalFloatSuffix = "_float"
+
+// checkDecimalFormat validates a decimalFormat: float, the default, string or both.
+func checkDecimalFormat(format string) error {
+	switch format {
+	case "", "float", "string", "both":
+		return nil
+	}
+	return fmt.Errorf("unknown decimalFormat %q, use float, string or both", format)
+}
+
+// isDecimalType reports whether a column type may not fit a float64.
+func isDecimalType(info gocql.TypeInfo) bool {
+	return info.Type() == gocql.TypeVarint || info.Type() == gocql.TypeDecimal
+}
+
+// decimalConverter returns the converter of a varint or decimal column for
+// the string and both decimalFormat: the exact value as text.
+func decimalConverter(info gocql.TypeInfo, format string) (columnConverter, bool) {
+	if !isDecimalType(info) || (format != "string" && format != "both") {
+		return columnConverter{}, false
+	}
+	return columnConverter{typ: "text", convert: func(val interface{}) interface{} {
+		switch t := val.(type) {
+		case *big.Int:
+			return t.String()
+		case *inf.Dec:
+			return t.String()
+		}
+		return nil
+	}}, true
+}
+
+// addDecimalFloats adds after the text field of each of the columns a field
+// of its values as float64, named column_float, for graphs.
+func addDecimalFloats(frame *data.Frame, columns []string) {
+	for _, name := range columns {
+		idx := fieldIndex(frame, name)
+		if idx < 0 {
+			continue
+		}
+		text := frame.Fields[idx]
+		values := make([]*float64, text.Len())
+		for i := range values {
+			if v, ok := text.ConcreteAt(i); ok {
+				if f, err := strconv.ParseFloat(v.(string), 64); err == nil {
+					values[i] = &f
+				}
+			}
+		}
+		field := data.NewField(name+decimalFloatSuffix, text.Labels, values)
+		frame.Fields = append(frame.Fields[:idx+1], append([]*data.Field{field}, frame.Fields[idx+1:]...)...)
+	}
+}
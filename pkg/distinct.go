@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// distinctQueryType is the query type listing the distinct values of a column.
+const distinctQueryType = "distinct"
+
+// distinctQuery returns the CQL listing the values of the query column. A
+// partition key column is read with SELECT DISTINCT, which reads a row per
+// partition, other columns are read from the first limit rows.
+func (settings *instanceSettings) distinctQuery(qm queryModel) (string, string, error) {
+	if qm.Keyspace == "" || qm.Table == "" || qm.Column == "" {
+		return "", "", errors.New("a distinct query requires a keyspace, a table and a column")
+	}
+	if err := checkIdentifier("keyspace", qm.Keyspace); err != nil {
+		return "", "", err
+	}
+	if err := checkIdentifier("table", qm.Table); err != nil {
+		return "", "", err
+	}
+	if err := checkIdentifier("column", qm.Column); err != nil {
+		return "", "", err
+	}
+	limit := qm.Limit
+	if limit == 0 {
+		limit = defaultTagValuesLimit
+	}
+	if limit < 0 || limit > maxTagValuesLimit {
+		return "", "", fmt.Errorf("limit must be between 1 and %d", maxTagValuesLimit)
+	}
+	keyspace := settings.resolveKeyspace(qm.Keyspace)
+	table := settings.resolveTable(keyspace, qm.Table)
+	column := settings.resolveColumn(keyspace, table, qm.Column)
+	columns, err := settings.schemaColumns(keyspace, table)
+	if err != nil {
+		return "", "", err
+	}
+	var partitionKey []string
+	isKey := false
+	for _, c := range columns {
+		if c.Kind == "partition_key" {
+			partitionKey = append(partitionKey, quoteIdentifier(c.Name))
+			isKey = isKey || c.Name == column
+		}
+	}
+	selected := quoteIdentifier(column)
+	if isKey {
+		// DISTINCT must select the whole partition key
+		selected = "DISTINCT " + strings.Join(partitionKey, ", ")
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM %s.%s", selected, quoteIdentifier(keyspace), quoteIdentifier(table))
+	if qm.Filter != "" {
+		stmt += " WHERE " + qm.Filter
+	}
+	stmt += fmt.Sprintf(" LIMIT %d", limit)
+	if qm.Filter != "" && !isKey {
+		stmt += " ALLOW FILTERING"
+	}
+	return stmt, column, nil
+}
+
+// distinctFieldValues returns the sorted distinct values of a frame field.
+func distinctFieldValues(frame *data.Frame, name string) []string {
+	for _, f := range frame.Fields {
+		if f.Name != name {
+			continue
+		}
+		seen := make(map[string]bool)
+		var res []string
+		for i := 0; i < f.Len(); i++ {
+			v, ok := f.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			text := fmt.Sprintf("%v", v)
+			if !seen[text] {
+				seen[text] = true
+				res = append(res, text)
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+	return nil
+}
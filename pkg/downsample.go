@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// bucketFunc returns the start of the bucket a time belongs to.
+type bucketFunc func(time.Time) time.Time
+
+// calendarBucket returns a bucket function aligned to calendar boundaries
+// in the given location: day, week (starting on Monday), month or year.
+func calendarBucket(unit string, loc *time.Location) (bucketFunc, bool) {
+	switch unit {
+	case "day":
+		return func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}, true
+	case "week":
+		return func(t time.Time) time.Time {
+			t = t.In(loc)
+			offset := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+		}, true
+	case "month":
+		return func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}, true
+	case "year":
+		return func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, loc)
+		}, true
+	}
+	return nil, false
+}
+
+// fixedBucket returns a bucket function of a fixed duration, aligned to
+// the epoch in the given location.
+func fixedBucket(d time.Duration, loc *time.Location) bucketFunc {
+	return func(t time.Time) time.Time {
+		_, offset := t.In(loc).Zone()
+		shift := time.Duration(offset) * time.Second
+		return t.Add(shift).Truncate(d).Add(-shift).In(loc)
+	}
+}
+
+// parseBucket parses a bucket setting, either a calendar unit (day, week,
+// month, year) or a duration (e.g. 5m), in the given IANA timezone.
+func parseBucket(bucket string, timezone string) (bucketFunc, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", timezone)
+		}
+	}
+	if f, ok := calendarBucket(strings.ToLower(bucket), loc); ok {
+		return f, nil
+	}
+	d, err := time.ParseDuration(bucket)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid bucket %q, use day, week, month, year or a duration", bucket)
+	}
+	return fixedBucket(d, loc), nil
+}
+
+// maxDataPointsBucket returns fixed buckets splitting the time range in at
+// most maxDataPoints buckets, no narrower than the query interval.
+func maxDataPointsBucket(from time.Time, to time.Time, maxDataPoints int64, interval time.Duration) bucketFunc {
+	width := to.Sub(from) / time.Duration(maxDataPoints)
+	if width < interval {
+		width = interval
+	}
+	// round up so the buckets never exceed maxDataPoints
+	width = (width + time.Millisecond - 1).Truncate(time.Millisecond)
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return fixedBucket(width, time.UTC)
+}
+
+// aggregator accumulates the values of a bucket.
+type aggregator struct {
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (a *aggregator) add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+}
+
+func (a *aggregator) value(fn string) *float64 {
+	if a.count == 0 {
+		if fn == "count" {
+			v := 0.0
+			return &v
+		}
+		return nil
+	}
+	var v float64
+	switch fn {
+	case "sum":
+		v = a.sum
+	case "min":
+		v = a.min
+	case "max":
+		v = a.max
+	case "count":
+		v = float64(a.count)
+	default:
+		v = a.sum / float64(a.count)
+	}
+	return &v
+}
+
+var aggregations = map[string]bool{"": true, "avg": true, "sum": true, "min": true, "max": true, "count": true}
+
+type bucketRow struct {
+	start   time.Time
+	factors []interface{}
+	aggs    []aggregator
+}
+
+// downsample aggregates the frame rows into time buckets. Rows are grouped
+// by bucket and by the values of the string fields, numeric fields are
+// aggregated with fn (avg, sum, min, max or count) and become nullable
+// float64 fields.
+func downsample(frame *data.Frame, bucket bucketFunc, fn string) (*data.Frame, error) {
+	if !aggregations[fn] {
+		return nil, fmt.Errorf("unsupported aggregation %q, use avg, sum, min, max or count", fn)
+	}
+	schema := frame.TimeSeriesSchema()
+	if schema.Type == data.TimeSeriesTypeNot {
+		return nil, errors.New("downsampling requires a time column and at least one numeric column")
+	}
+	var rows []*bucketRow
+	index := make(map[string]*bucketRow)
+	timeField := frame.Fields[schema.TimeIndex]
+	for i := 0; i < frame.Rows(); i++ {
+		t, ok := timeAt(timeField, i)
+		if !ok {
+			continue
+		}
+		start := bucket(t)
+		factors := make([]interface{}, len(schema.FactorIndices))
+		var key strings.Builder
+		key.WriteString(start.String())
+		for j, idx := range schema.FactorIndices {
+			factors[j] = frame.Fields[idx].At(i)
+			v, _ := frame.Fields[idx].ConcreteAt(i)
+			fmt.Fprintf(&key, "\x00%v", v)
+		}
+		row, ok := index[key.String()]
+		if !ok {
+			row = &bucketRow{start: start, factors: factors, aggs: make([]aggregator, len(schema.ValueIndices))}
+			index[key.String()] = row
+			rows = append(rows, row)
+		}
+		for j, idx := range schema.ValueIndices {
+			v, err := frame.Fields[idx].FloatAt(i)
+			if err != nil || math.IsNaN(v) {
+				continue
+			}
+			row.aggs[j].add(v)
+		}
+	}
+	res := data.NewFrame(frame.Name)
+	res.Meta = frame.Meta
+	res.Fields = make([]*data.Field, len(frame.Fields))
+	res.Fields[schema.TimeIndex] = data.NewField(timeField.Name, timeField.Labels, make([]time.Time, len(rows)))
+	for j, idx := range schema.FactorIndices {
+		f := data.NewFieldFromFieldType(frame.Fields[idx].Type(), len(rows))
+		f.Name, f.Labels = frame.Fields[idx].Name, frame.Fields[idx].Labels
+		for i, row := range rows {
+			f.Set(i, row.factors[j])
+		}
+		res.Fields[idx] = f
+	}
+	for j, idx := range schema.ValueIndices {
+		f := data.NewField(frame.Fields[idx].Name, frame.Fields[idx].Labels, make([]*float64, len(rows)))
+		for i, row := range rows {
+			f.Set(i, row.aggs[j].value(fn))
+		}
+		res.Fields[idx] = f
+	}
+	for i, row := range rows {
+		res.Fields[schema.TimeIndex].Set(i, row.start)
+	}
+	return sortByTime(res, schema.TimeIndex), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// defaultCountTimeout bounds the COUNT query of /count-estimate.
+const defaultCountTimeout = 5 * time.Second
+
+// countEstimate is the response of /count-estimate.
+type countEstimate struct {
+	Estimate int64 `json:"estimate"`
+	// Method is "count" when the rows were counted and "size_estimates" when
+	// the partitions estimate of system.size_estimates was used.
+	Method string `json:"method"`
+	Exact  bool   `json:"exact"`
+	// Unit is what the estimate counts: "rows", or "partitions" for the
+	// size estimates, which understate the rows of tables with clustering
+	// keys by the number of rows per partition.
+	Unit string `json:"unit"`
+}
+
+// countStatement builds the COUNT query of a table, bounded by a server side timeout.
+func countStatement(keyspace string, table string, where string, timeout time.Duration) string {
+	stmt := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", keyspace, table)
+	if where != "" {
+		stmt += " WHERE " + where
+	}
+	return stmt + fmt.Sprintf(" USING TIMEOUT %dms", timeout.Milliseconds())
+}
+
+// countRows runs a COUNT query built by countStatement.
+func (settings *instanceSettings) countRows(ctx context.Context, stmt string) (int64, error) {
+	session, err := settings.getSession("")
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := session.Query(stmt).WithContext(ctx).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// estimatePartitions sums the partitions estimates of a table over all the token ranges.
+func (settings *instanceSettings) estimatePartitions(keyspace string, table string) (int64, error) {
+	session, err := settings.getSession("")
+	if err != nil {
+		return 0, err
+	}
+	var total, partitions int64
+	iter := session.Query("SELECT partitions_count FROM system.size_estimates WHERE keyspace_name = ? AND table_name = ?",
+		normalizeIdentifier(keyspace), normalizeIdentifier(table)).Iter()
+	for iter.Scan(&partitions) {
+		total += partitions
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// handleCountEstimate returns an approximate number of rows for a table, used for pagination.
+// It tries a bounded COUNT first and falls back to the partitions estimate of the size
+// estimates when it times out.
+func (td *SampleDatasource) handleCountEstimate(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	params := r.URL.Query()
+	keyspace, table, where := params.Get("keyspace"), params.Get("table"), params.Get("where")
+	if keyspace == "" || table == "" {
+		writeError(w, http.StatusBadRequest, errors.New("keyspace and table are required"))
+		return
+	}
+	if err := checkIdentifier("keyspace", keyspace); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := checkIdentifier("table", table); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	timeout, err := parseDuration("timeout", params.Get("timeout"), defaultCountTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	stmt := countStatement(keyspace, table, where, timeout)
+	if err := instance.checkQuery(stmt); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	count, err := instance.countRows(r.Context(), stmt)
+	if err == nil {
+		writeJSON(w, http.StatusOK, countEstimate{Estimate: count, Method: "count", Exact: true, Unit: "rows"})
+		return
+	}
+	log.DefaultLogger.Debug("Bounded count failed, using size estimates", "err", err)
+	if where != "" {
+		// the size estimates can not take the filter into account
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	partitions, err := instance.estimatePartitions(keyspace, table)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, countEstimate{Estimate: partitions, Method: "size_estimates", Unit: "partitions"})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// exploreApp is the app of the queries run from Explore.
+const exploreApp = "explore"
+
+// defaultExploreLimit is the LIMIT added to Explore queries when exploreLimit is not set.
+const defaultExploreLimit = 1000
+
+// limitClause matches a LIMIT clause, PER PARTITION LIMIT included.
+var limitClause = regexp.MustCompile(`(?i)(\bper\s+partition\s+)?\blimit\s+(\d+|\?)`)
+
+// trailingClauses matches the clauses that follow LIMIT in a SELECT.
+var trailingClauses = regexp.MustCompile(`(?i)(\s+(allow\s+filtering|bypass\s+cache|using\s+timeout\s+\S+))*\s*;?\s*$`)
+
+// selectStatement matches a SELECT statement.
+var selectStatement = regexp.MustCompile(`(?i)^\s*select\b`)
+
+// hasLimit reports whether a query limits its rows, PER PARTITION LIMIT does not.
+func hasLimit(query string) bool {
+	for _, m := range limitClause.FindAllStringSubmatch(query, -1) {
+		if m[1] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// exploreLimit returns the LIMIT of queries run from Explore, 0 when they are not limited.
+func (settings *instanceSettings) exploreLimit() int {
+	switch n := settings.settings.ExploreLimit; {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultExploreLimit
+	default:
+		return n
+	}
+}
+
+// sampleQuery adds a LIMIT to a SELECT without one, so an interactive
+// query in Explore does not read a huge table. It reports whether the
+// limit was added.
+func sampleQuery(query string, limit int) (string, bool) {
+	if limit <= 0 || !selectStatement.MatchString(query) || hasLimit(query) {
+		return query, false
+	}
+	loc := trailingClauses.FindStringIndex(query)
+	return strings.TrimRight(query[:loc[0]], " \t\n") + fmt.Sprintf(" LIMIT %d", limit) + query[loc[0]:], true
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// arrowContentType is the media type of Arrow IPC file responses.
+const arrowContentType = "application/vnd.apache.arrow.file"
+
+// exportedFrame is the JSON representation of a frame in /query-json.
+type exportedFrame struct {
+	Name   string                   `json:"name"`
+	Fields []string                 `json:"fields"`
+	Rows   []map[string]interface{} `json:"rows"`
+}
+
+// parseEpochMillis parses a time range parameter in epoch milliseconds.
+func parseEpochMillis(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return def, errors.New("time range parameters must be epoch milliseconds")
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// pageSink receives the rows of a query page by page as they are read,
+// instead of the query returning them in its frame.
+type pageSink func(frame *data.Frame) error
+
+type pageSinkKey struct{}
+
+// withPageSink streams the rows of the query run with the context to sink.
+func withPageSink(ctx context.Context, sink pageSink) context.Context {
+	return context.WithValue(ctx, pageSinkKey{}, sink)
+}
+
+func pageSinkFromContext(ctx context.Context) pageSink {
+	sink, _ := ctx.Value(pageSinkKey{}).(pageSink)
+	return sink
+}
+
+// emptyFrame returns a frame with the fields of frame, without rows.
+func emptyFrame(frame *data.Frame) *data.Frame {
+	res := data.NewFrame(frame.Name)
+	for _, f := range frame.Fields {
+		field := data.NewFieldFromFieldType(f.Type(), 0)
+		field.Name, field.Labels, field.Config = f.Name, f.Labels, f.Config
+		res.Fields = append(res.Fields, field)
+	}
+	return res
+}
+
+// streamPage passes the rows of a page to the sink, with their columns
+// expanded like the rows of a returned frame, and returns an empty frame
+// with the same fields for the next page.
+func streamPage(sink pageSink, frame *data.Frame, raw *rawColumns, decimalColumns []string, selectJSON bool, fields []jsonField) (*data.Frame, error) {
+	next := emptyFrame(frame)
+	if raw != nil {
+		raw.expand(frame)
+		raw.reset()
+	}
+	addDecimalFloats(frame, decimalColumns)
+	if selectJSON {
+		expandSelectJSON(frame)
+	}
+	if len(fields) > 0 && len(frame.Fields) > 0 {
+		extractJSONFields(frame, fields)
+	}
+	return next, sink(frame)
+}
+
+// runResourceQuery executes the query posted in the request body, using the
+// from and to parameters (epoch milliseconds) as the time range, the last
+// hour by default. The query is run like the queries of a dashboard, through
+// the rate limit and registered for /cancel. With a sink, the rows are
+// streamed to it instead of being returned.
+func (td *SampleDatasource) runResourceQuery(r *http.Request, sink pageSink) ([]*data.Frame, error) {
+	if r.Method != http.MethodPost {
+		return nil, errors.New("use POST with the query as the body")
+	}
+	instance, err := td.getInstance(r)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, errors.New("the request body must hold the query")
+	}
+	now := time.Now()
+	params := r.URL.Query()
+	from, err := parseEpochMillis(params.Get("from"), now.Add(-time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseEpochMillis(params.Get("to"), now)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context()
+	if sink != nil {
+		ctx = withPageSink(ctx, sink)
+	}
+	headers := map[string]string{"X-Dashboard-Uid": r.Header.Get("X-Dashboard-Uid"), "X-Panel-Id": r.Header.Get("X-Panel-Id")}
+	slots := make(chan struct{}, instance.maxConcurrentQueries())
+	res := td.runQuery(ctx, instance, pluginUser(httpadapter.UserFromContext(ctx)), headers, backend.DataQuery{
+		RefID:     "export",
+		JSON:      body,
+		TimeRange: backend.TimeRange{From: from, To: to},
+	}, slots, now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return res.Frames, nil
+}
+
+func frameRows(frame *data.Frame) exportedFrame {
+	res := exportedFrame{Name: frame.Name, Rows: make([]map[string]interface{}, frame.Rows())}
+	for _, f := range frame.Fields {
+		res.Fields = append(res.Fields, f.Name)
+	}
+	for i := range res.Rows {
+		row := make(map[string]interface{}, len(frame.Fields))
+		for _, f := range frame.Fields {
+			row[f.Name] = f.At(i)
+		}
+		res.Rows[i] = row
+	}
+	return res
+}
+
+func acceptsArrow(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/vnd.apache.arrow")
+}
+
+// writeArrow writes a single frame as an Arrow IPC file.
+func writeArrow(w http.ResponseWriter, frames []*data.Frame) {
+	if len(frames) != 1 {
+		writeError(w, http.StatusNotAcceptable, errors.New("arrow output requires a query returning a single frame"))
+		return
+	}
+	body, err := frames[0].MarshalArrow()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", arrowContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.DefaultLogger.Warn("Failed writing resource response", "err", err)
+	}
+}
+
+// rowWriter writes the rows of an export as a JSON array, page by page as
+// the query reads them.
+type rowWriter struct {
+	w       http.ResponseWriter
+	started bool
+	rows    int
+}
+
+// page writes the rows of a frame and sends them.
+func (rw *rowWriter) page(frame *data.Frame) error {
+	var buf bytes.Buffer
+	if !rw.started {
+		rw.w.Header().Set("Content-Type", "application/json")
+		rw.w.WriteHeader(http.StatusOK)
+		buf.WriteByte('[')
+		rw.started = true
+	}
+	for _, row := range frameRows(frame).Rows {
+		if rw.rows > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		rw.rows++
+	}
+	if _, err := rw.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// handleExport runs a query and streams the rows of its frame as a JSON
+// array or, when requested in the Accept header, returns them as Arrow IPC.
+func (td *SampleDatasource) handleExport(w http.ResponseWriter, r *http.Request) {
+	if acceptsArrow(r) {
+		frames, err := td.runResourceQuery(r, nil)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeArrow(w, frames)
+		return
+	}
+	rows := &rowWriter{w: w}
+	frames, err := td.runResourceQuery(r, rows.page)
+	if err == nil && len(frames) > 0 {
+		// the query types that are not streamed, e.g. variable queries
+		err = rows.page(frames[0])
+	}
+	if err != nil {
+		if !rows.started {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// the status was sent with the first rows, the array is left open
+		// so the export can not be mistaken for a complete one
+		log.DefaultLogger.Warn("Export failed after its first rows", "rows", rows.rows, "err", err)
+		return
+	}
+	if !rows.started {
+		err = rows.page(data.NewFrame(""))
+	}
+	if err == nil {
+		_, err = w.Write([]byte("]"))
+	}
+	if err != nil {
+		log.DefaultLogger.Warn("Failed writing resource response", "err", err)
+	}
+}
+
+// handleQueryJSON runs a query and returns all its frames as JSON, or as
+// Arrow IPC when requested in the Accept header.
+func (td *SampleDatasource) handleQueryJSON(w http.ResponseWriter, r *http.Request) {
+	frames, err := td.runResourceQuery(r, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if acceptsArrow(r) {
+		writeArrow(w, frames)
+		return
+	}
+	res := make([]exportedFrame, len(frames))
+	for i, frame := range frames {
+		res[i] = frameRows(frame)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
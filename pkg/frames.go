@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timeAt returns the time of a time field row, ok is false for null values.
+func timeAt(field *data.Field, idx int) (time.Time, bool) {
+	v, ok := field.ConcreteAt(idx)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := v.(time.Time)
+	return t, ok
+}
+
+// timeFieldIndex returns the index of the first time field, -1 when there is none.
+func timeFieldIndex(frame *data.Frame) int {
+	for i, f := range frame.Fields {
+		if isTimeField(f) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reorderRows returns a copy of the frame with the rows in the order of rows,
+// rows holds indexes of the original frame rows. The metadata is kept.
+func reorderRows(frame *data.Frame, rows []int) *data.Frame {
+	res := frame.EmptyCopy()
+	res.Meta = frame.Meta
+	for i, field := range frame.Fields {
+		res.Fields[i] = data.NewFieldFromFieldType(field.Type(), len(rows))
+		res.Fields[i].Name = field.Name
+		res.Fields[i].Labels = field.Labels
+		res.Fields[i].Config = field.Config
+		for j, row := range rows {
+			res.Fields[i].Set(j, field.At(row))
+		}
+	}
+	return res
+}
+
+// sortByTime sorts the frame rows by the time field at timeIndex, ascending.
+// Rows with a null time are placed first.
+func sortByTime(frame *data.Frame, timeIndex int) *data.Frame {
+	field := frame.Fields[timeIndex]
+	rows := make([]int, field.Len())
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		ti, iok := timeAt(field, rows[i])
+		tj, jok := timeAt(field, rows[j])
+		if !iok || !jok {
+			return !iok && jok
+		}
+		return ti.Before(tj)
+	})
+	return reorderRows(frame, rows)
+}
+
+// toTimeSeries converts a table frame to a time series frame, sorted by
+// time. Long frames (with string columns) are converted to wide frames with
+// the string values as labels, missing values are filled as set by fill
+// (zero values when nil).
+func toTimeSeries(frame *data.Frame, fill *data.FillMissing) (*data.Frame, error) {
+	schema := frame.TimeSeriesSchema()
+	switch schema.Type {
+	case data.TimeSeriesTypeNot:
+		return nil, errors.New("the result can not be used as a time series, it requires a time column and at least one numeric column")
+	case data.TimeSeriesTypeLong:
+		if frame.Rows() == 0 {
+			return sortByTime(frame, schema.TimeIndex), nil
+		}
+		return data.LongToWide(sortByTime(frame, schema.TimeIndex), fill)
+	}
+	return sortByTime(frame, schema.TimeIndex), nil
+}
+
+// dualFormatFrames returns the table frame along with its time series
+// representation, so the table and graph views of a panel share one query.
+func dualFormatFrames(frame *data.Frame) []*data.Frame {
+	table := frame
+	if table.Meta == nil {
+		table.Meta = &data.FrameMeta{}
+	}
+	table.Meta.PreferredVisualization = data.VisTypeTable
+	series, err := toTimeSeries(frame, nil)
+	if err != nil {
+		table.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: err.Error()})
+		return []*data.Frame{table}
+	}
+	meta := *table.Meta
+	meta.PreferredVisualization = data.VisTypeGraph
+	series.Meta = &meta
+	series.Name = frame.Name + "_series"
+	return []*data.Frame{table, series}
+}
+
+// emptyResultModes are the supported treatments of queries returning no rows:
+// "frame" returns the empty frame with its typed fields, "none" returns no
+// frames so panels show no data and "notice" returns the empty frame with
+// an info notice.
+var emptyResultModes = map[string]bool{"": true, "frame": true, "none": true, "notice": true}
+
+func checkEmptyResultMode(mode string) error {
+	if !emptyResultModes[mode] {
+		return fmt.Errorf("unsupported emptyResult %q, use frame, none or notice", mode)
+	}
+	return nil
+}
+
+// emptyResultFrames applies the empty result mode to a frame without rows.
+func emptyResultFrames(frame *data.Frame, mode string) []*data.Frame {
+	switch mode {
+	case "none":
+		return nil
+	case "notice":
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityInfo, Text: "The query returned no rows"})
+	}
+	return []*data.Frame{frame}
+}
+
+// orderByClause matches an explicit ORDER BY, whose order is kept as written.
+var orderByClause = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// queryTableColumns returns the columns of the keyspace qualified table a
+// query reads, nil when it is not known.
+func (settings *instanceSettings) queryTableColumns(query string) []columnInfo {
+	refs, _ := queryTableRefs(query)
+	if len(refs) == 0 || refs[0].keyspace == "" || refs[0].table == "" {
+		return nil
+	}
+	columns, err := settings.schemaColumns(refs[0].keyspace, refs[0].table)
+	if err != nil {
+		return nil
+	}
+	return columns
+}
+
+// descendingTimeColumns returns the timestamp clustering columns stored in
+// descending order of the table a query reads.
+func (settings *instanceSettings) descendingTimeColumns(query string) map[string]bool {
+	var res map[string]bool
+	for _, c := range settings.queryTableColumns(query) {
+		if c.Kind == "clustering" && c.ClusteringOrder == "desc" {
+			if res == nil {
+				res = make(map[string]bool)
+			}
+			res[c.Name] = true
+		}
+	}
+	return res
+}
+
+// ascendingTime returns the frame with its rows in ascending time order when
+// its time field is a descending clustering column, so graphs are not drawn
+// backwards. Rows of a single partition are simply reversed.
+func ascendingTime(frame *data.Frame, descending map[string]bool) (*data.Frame, bool) {
+	idx := -1
+	for i, f := range frame.Fields {
+		if f.Type() == data.FieldTypeTime || f.Type() == data.FieldTypeNullableTime {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || !descending[frame.Fields[idx].Name] || frame.Rows() < 2 {
+		return frame, false
+	}
+	field := frame.Fields[idx]
+	rows := make([]int, field.Len())
+	reversed := true
+	for i := range rows {
+		rows[i] = len(rows) - 1 - i
+		if i > 0 {
+			prev, pok := timeAt(field, i-1)
+			cur, cok := timeAt(field, i)
+			if pok && cok && cur.After(prev) {
+				reversed = false
+			}
+		}
+	}
+	if !reversed {
+		// several partitions, each in descending order
+		return sortByTime(frame, idx), true
+	}
+	return reorderRows(frame, rows), true
+}
+
+// keysFirst orders the frame fields as the partition keys, the clustering
+// keys, in their key order, then the other fields as selected. Fields that
+// are not columns of the table (_host, aliases, functions) come last.
+func keysFirst(frame *data.Frame, columns []columnInfo) {
+	rank := func(name string) int {
+		for _, c := range columns {
+			if c.Name != name {
+				continue
+			}
+			switch c.Kind {
+			case "partition_key":
+				return c.Position
+			case "clustering":
+				return len(columns) + c.Position
+			}
+		}
+		return 2 * len(columns)
+	}
+	sort.SliceStable(frame.Fields, func(i, j int) bool {
+		return rank(frame.Fields[i].Name) < rank(frame.Fields[j].Name)
+	})
+}
+
+// formatFrame returns the frame in the table or time_series query format.
+// A table is returned as is, a time series is sorted by its time field and
+// long frames are converted to wide frames. A result that can not be a time
+// series is an error. Missing values of converted long frames are filled as
+// set by fill.
+func formatFrame(frame *data.Frame, format string, fill *data.FillMissing) (*data.Frame, error) {
+	meta := data.FrameMeta{}
+	if frame.Meta != nil {
+		meta = *frame.Meta
+	}
+	switch format {
+	case "table":
+		meta.PreferredVisualization = data.VisTypeTable
+		frame.Meta = &meta
+		return frame, nil
+	case "time_series":
+		series, err := toTimeSeries(frame, fill)
+		if err != nil {
+			return nil, err
+		}
+		meta.PreferredVisualization = data.VisTypeGraph
+		series.Meta = &meta
+		series.Name, series.RefID = frame.Name, frame.RefID
+		return series, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, use table, time_series or logs", format)
+}
+
+// pivotLabels converts a long result (time, label columns, values) to a wide
+// time series frame with a field per value column and label values, the
+// label values are set as the field labels. Label columns of other types
+// than text are converted to text, text columns that are not label columns
+// are dropped as they would split the series. Missing values are filled as
+// set by fill.
+func pivotLabels(frame *data.Frame, labels []string, fill *data.FillMissing) (*data.Frame, error) {
+	ts := -1
+	for i, f := range frame.Fields {
+		if isTimeField(f) {
+			ts = i
+			break
+		}
+	}
+	if ts < 0 {
+		return nil, errors.New("labelColumns require a time column")
+	}
+	fields := []*data.Field{frame.Fields[ts]}
+	for _, name := range labels {
+		idx := fieldIndex(frame, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("label column %s is not in the result", name)
+		}
+		field := frame.Fields[idx]
+		if !isStringField(field) {
+			values := make([]*string, field.Len())
+			for i := range values {
+				if v, ok := field.ConcreteAt(i); ok {
+					s := fmt.Sprint(v)
+					values[i] = &s
+				}
+			}
+			field = data.NewField(field.Name, nil, values)
+		}
+		fields = append(fields, field)
+	}
+	var dropped []string
+	values := 0
+	for i, f := range frame.Fields {
+		switch {
+		case i == ts || containsString(labels, f.Name):
+		case f.Type().Numeric():
+			fields = append(fields, f)
+			values++
+		default:
+			dropped = append(dropped, f.Name)
+		}
+	}
+	if values == 0 {
+		return nil, errors.New("labelColumns require at least one numeric column")
+	}
+	long := data.NewFrame(frame.Name, fields...)
+	long.RefID, long.Meta = frame.RefID, frame.Meta
+	if len(dropped) > 0 {
+		long.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("columns %s are neither label nor numeric columns and were left out of the series", strings.Join(dropped, ", ")),
+		})
+	}
+	if long.Rows() == 0 {
+		return long, nil
+	}
+	return data.LongToWide(sortByTime(long, 0), fill)
+}
+
+// partitionFrames splits the rows of a frame into a frame per combination
+// of values of the partition columns, in the order the combinations are
+// first read. The partition columns are removed and their values set as
+// the labels of the other fields, so each frame is a series of its own for
+// per series overrides and repeated panels.
+func partitionFrames(frame *data.Frame, columns []string) ([]*data.Frame, error) {
+	indexes := make([]int, len(columns))
+	for i, name := range columns {
+		if indexes[i] = fieldIndex(frame, name); indexes[i] < 0 {
+			return nil, fmt.Errorf("partitionBy column %s is not in the result", name)
+		}
+	}
+	var keys []string
+	groups := make(map[string][]int)
+	labels := make(map[string]data.Labels)
+	for row := 0; row < frame.Rows(); row++ {
+		values := data.Labels{}
+		for i, idx := range indexes {
+			if v, ok := frame.Fields[idx].ConcreteAt(row); ok {
+				values[columns[i]] = fmt.Sprint(v)
+			} else {
+				values[columns[i]] = ""
+			}
+		}
+		key := values.String()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			labels[key] = values
+		}
+		groups[key] = append(groups[key], row)
+	}
+	res := make([]*data.Frame, 0, len(keys))
+	for _, key := range keys {
+		part := reorderRows(frame, groups[key])
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			meta.Notices = append([]data.Notice(nil), meta.Notices...)
+			part.Meta = &meta
+		}
+		fields := part.Fields[:0]
+		for _, f := range part.Fields {
+			if containsString(columns, f.Name) {
+				continue
+			}
+			if !isTimeField(f) {
+				merged := data.Labels{}
+				for k, v := range f.Labels {
+					merged[k] = v
+				}
+				for k, v := range labels[key] {
+					merged[k] = v
+				}
+				f.Labels = merged
+			}
+			fields = append(fields, f)
+		}
+		part.Fields = fields
+		part.Name = key
+		res = append(res, part)
+	}
+	return res, nil
+}
+
+// parseFillMissing returns how missing values of long to wide conversions
+// are filled: previous, null or value (fillValue). Empty fills zero values.
+func parseFillMissing(mode string, value float64) (*data.FillMissing, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "previous":
+		return &data.FillMissing{Mode: data.FillModePrevious}, nil
+	case "null":
+		return &data.FillMissing{Mode: data.FillModeNull}, nil
+	case "value":
+		return &data.FillMissing{Mode: data.FillModeValue, Value: value}, nil
+	}
+	return nil, fmt.Errorf("unknown fill %q, use previous, null or value", mode)
+}
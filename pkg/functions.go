@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// serverVersion is the product and version of the connected cluster.
+type serverVersion struct {
+	Product string `json:"product"`
+	Version string `json:"version"`
+}
+
+// cqlFunction is a built-in function the editor may suggest. Since is the
+// first Scylla open source version providing it, SinceEnterprise the first
+// Scylla Enterprise one. Arguments and ReturnType are set for user defined
+// functions.
+type cqlFunction struct {
+	Name            string   `json:"name"`
+	Kind            string   `json:"kind"`
+	Arguments       []string `json:"arguments,omitempty"`
+	ReturnType      string   `json:"returnType,omitempty"`
+	Since           string   `json:"-"`
+	SinceEnterprise string   `json:"-"`
+}
+
+// cqlFunctions are the built-in CQL functions by the version introducing them.
+var cqlFunctions = []cqlFunction{
+	{Name: "count", Kind: "aggregate"},
+	{Name: "min", Kind: "aggregate"},
+	{Name: "max", Kind: "aggregate"},
+	{Name: "sum", Kind: "aggregate"},
+	{Name: "avg", Kind: "aggregate"},
+	{Name: "token", Kind: "scalar"},
+	{Name: "writetime", Kind: "scalar"},
+	{Name: "ttl", Kind: "scalar"},
+	{Name: "now", Kind: "scalar"},
+	{Name: "uuid", Kind: "scalar"},
+	{Name: "minTimeuuid", Kind: "scalar"},
+	{Name: "maxTimeuuid", Kind: "scalar"},
+	{Name: "dateOf", Kind: "scalar"},
+	{Name: "unixTimestampOf", Kind: "scalar"},
+	{Name: "toDate", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "toTimestamp", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "toUnixTimestamp", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "currentTimestamp", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "currentDate", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "currentTime", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "currentTimeUUID", Kind: "scalar", Since: "2.0", SinceEnterprise: "2018.1"},
+	{Name: "toJson", Kind: "scalar", Since: "2.3", SinceEnterprise: "2019.1"},
+	{Name: "fromJson", Kind: "scalar", Since: "2.3", SinceEnterprise: "2019.1"},
+	{Name: "cast", Kind: "scalar", Since: "3.0", SinceEnterprise: "2019.1"},
+}
+
+// compareVersions compares dotted numeric versions, missing or non numeric
+// parts count as zero.
+func compareVersions(a string, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(strings.SplitN(pa[i], "-", 2)[0])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(strings.SplitN(pb[i], "-", 2)[0])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// supports reports whether a function is available in a server version.
+// Functions of unknown servers are all listed.
+func (f cqlFunction) supports(v serverVersion) bool {
+	since := f.Since
+	if v.Product == "scylla-enterprise" {
+		since = f.SinceEnterprise
+	}
+	return since == "" || v.Version == "" || v.Product == "cassandra" || compareVersions(v.Version, since) >= 0
+}
+
+// serverVersion detects the product and version of the cluster. Scylla
+// reports a Cassandra compatible release_version in system.local and its own
+// version in system.versions, Enterprise versions are numbered by year.
+func (settings *instanceSettings) serverVersion() (serverVersion, error) {
+	v, err := settings.schema.get("version", func() (interface{}, error) {
+		session, err := settings.getSession("")
+		if err != nil {
+			return nil, err
+		}
+		var version string
+		if err := session.Query("SELECT version FROM system.versions WHERE key = 'local'").Scan(&version); err == nil {
+			product := "scylla"
+			if n, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0]); err == nil && n >= 2017 {
+				product = "scylla-enterprise"
+			}
+			return serverVersion{Product: product, Version: version}, nil
+		}
+		if err := session.Query("SELECT release_version FROM system.local").Scan(&version); err != nil {
+			return nil, err
+		}
+		return serverVersion{Product: "cassandra", Version: version}, nil
+	})
+	if err != nil {
+		return serverVersion{}, err
+	}
+	return v.(serverVersion), nil
+}
+
+// userFunctions returns the user defined functions and aggregates of the
+// keyspaces the instance may query, qualified by their keyspace. Clusters
+// without user defined functions return none.
+func (settings *instanceSettings) userFunctions() []cqlFunction {
+	keyspaces, err := settings.schemaKeyspaces()
+	if err != nil {
+		return nil
+	}
+	var res []cqlFunction
+	for _, ks := range keyspaces {
+		functions, err := settings.schemaFunctions(ks)
+		if err != nil {
+			break
+		}
+		for _, f := range functions {
+			res = append(res, cqlFunction{Name: ks + "." + f.Name, Kind: f.Kind, Arguments: f.Arguments, ReturnType: f.ReturnType})
+		}
+	}
+	return res
+}
+
+// functionsResponse is the response of /functions.
+type functionsResponse struct {
+	serverVersion
+	Functions []cqlFunction `json:"functions"`
+}
+
+// handleFunctions serves /functions, the CQL functions the connected server
+// supports so the editor does not suggest functions it rejects.
+func (td *SampleDatasource) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	version, err := instance.serverVersion()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	res := functionsResponse{serverVersion: version, Functions: []cqlFunction{}}
+	for _, f := range cqlFunctions {
+		if f.supports(version) {
+			res.Functions = append(res.Functions, f)
+		}
+	}
+	res.Functions = append(res.Functions, instance.userFunctions()...)
+	writeJSON(w, http.StatusOK, res)
+}
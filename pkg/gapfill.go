@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// maxGapFillRows bounds the rows of a gap filled frame.
+const maxGapFillRows = 100000
+
+// gapFillOptions are the query options of gap filling.
+type gapFillOptions struct {
+	GapFill     string `json:"gapFill"`
+	GapInterval string `json:"gapInterval"`
+	Bucket      string `json:"bucket"`
+}
+
+// gapStep returns the interval of the points of a gap filled series: the
+// gapInterval, or else the bucket of the query, or else the width of the
+// points the panel draws, as the rows are downsampled to.
+func gapStep(opts gapFillOptions, q backend.DataQuery) (time.Duration, error) {
+	if opts.GapInterval != "" {
+		d, err := time.ParseDuration(opts.GapInterval)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid gapInterval %q", opts.GapInterval)
+		}
+		return d, nil
+	}
+	if opts.Bucket != "" {
+		d, err := time.ParseDuration(opts.Bucket)
+		if err != nil {
+			return 0, fmt.Errorf("gap filling calendar buckets requires a gapInterval")
+		}
+		return d, nil
+	}
+	width := q.Interval
+	if q.MaxDataPoints > 0 {
+		if w := q.TimeRange.To.Sub(q.TimeRange.From) / time.Duration(q.MaxDataPoints); w > width {
+			width = w
+		}
+	}
+	if width <= 0 {
+		return 0, errors.New("gap filling requires a gapInterval, a bucket or the query interval")
+	}
+	return width, nil
+}
+
+// fillGaps returns a copy of a wide time series with a point inserted every
+// step in the gaps between its rows. The inserted values are null, zero or
+// the previous values as set by mode, the numeric value fields become
+// nullable float64 fields. The other value fields (e.g. booleans or a second
+// time field) keep their values, nullable, and are null in the inserted
+// points.
+func fillGaps(frame *data.Frame, step time.Duration, mode string) (*data.Frame, error) {
+	schema := frame.TimeSeriesSchema()
+	frame = sortByTime(frame, schema.TimeIndex)
+	timeField := frame.Fields[schema.TimeIndex]
+	var numeric []int
+	for _, idx := range schema.ValueIndices {
+		if frame.Fields[idx].Type().Numeric() {
+			numeric = append(numeric, idx)
+		}
+	}
+	times := make([]time.Time, 0, frame.Rows())
+	// sources are the rows of frame the points come from, -1 for the inserted ones
+	sources := make([]int, 0, frame.Rows())
+	values := make([][]*float64, len(numeric))
+	appendRow := func(t time.Time, source int, row []*float64) {
+		times = append(times, t)
+		sources = append(sources, source)
+		for j := range values {
+			values[j] = append(values[j], row[j])
+		}
+	}
+	for i := 0; i < frame.Rows(); i++ {
+		t, ok := timeAt(timeField, i)
+		if !ok {
+			continue
+		}
+		row := make([]*float64, len(numeric))
+		for j, idx := range numeric {
+			if _, ok := frame.Fields[idx].ConcreteAt(i); !ok {
+				continue
+			}
+			if v, err := frame.Fields[idx].FloatAt(i); err == nil {
+				row[j] = &v
+			}
+		}
+		appendRow(t, i, row)
+		next, ok := t, false
+		for k := i + 1; k < frame.Rows() && !ok; k++ {
+			next, ok = timeAt(timeField, k)
+		}
+		if !ok {
+			continue
+		}
+		if int64(next.Sub(t)/step)+int64(len(times)) > maxGapFillRows {
+			return nil, fmt.Errorf("gap filling would return more than %d points, use a wider gapInterval", maxGapFillRows)
+		}
+		// a point half a step or less before the next row is jitter, not a gap
+		for g := t.Add(step); next.Sub(g) > step/2; g = g.Add(step) {
+			gap := make([]*float64, len(row))
+			for j := range gap {
+				switch mode {
+				case "zero":
+					zero := 0.0
+					gap[j] = &zero
+				case "previous":
+					gap[j] = row[j]
+				}
+			}
+			appendRow(g, -1, gap)
+		}
+	}
+	res := data.NewFrame(frame.Name)
+	res.Meta = frame.Meta
+	res.Fields = make([]*data.Field, len(frame.Fields))
+	res.Fields[schema.TimeIndex] = data.NewField(timeField.Name, timeField.Labels, times)
+	res.Fields[schema.TimeIndex].Config = timeField.Config
+	for j, idx := range numeric {
+		f := data.NewField(frame.Fields[idx].Name, frame.Fields[idx].Labels, values[j])
+		f.Config = frame.Fields[idx].Config
+		res.Fields[idx] = f
+	}
+	for _, idx := range schema.ValueIndices {
+		if res.Fields[idx] != nil {
+			continue
+		}
+		src := frame.Fields[idx]
+		f := data.NewFieldFromFieldType(src.Type().NullableType(), len(sources))
+		f.Name, f.Labels, f.Config = src.Name, src.Labels, src.Config
+		for i, source := range sources {
+			if source < 0 {
+				continue
+			}
+			if v, ok := src.ConcreteAt(source); ok {
+				f.SetConcrete(i, v)
+			}
+		}
+		res.Fields[idx] = f
+	}
+	return res, nil
+}
+
+// gapFill fills the gaps of the time series frames of a query response as
+// set by its gapFill option: null, zero or previous.
+func gapFill(frames []*data.Frame, q backend.DataQuery) error {
+	var opts gapFillOptions
+	if json.Unmarshal(q.JSON, &opts) != nil || opts.GapFill == "" {
+		return nil
+	}
+	switch opts.GapFill {
+	case "null", "zero", "previous":
+	default:
+		return fmt.Errorf("unknown gapFill %q, use null, zero or previous", opts.GapFill)
+	}
+	step, err := gapStep(opts, q)
+	if err != nil {
+		return err
+	}
+	for i, frame := range frames {
+		switch frame.TimeSeriesSchema().Type {
+		case data.TimeSeriesTypeNot:
+			continue
+		case data.TimeSeriesTypeLong:
+			frame.AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityInfo,
+				Text:     "gaps are only filled in wide time series, set the time_series format, labelColumns or convertToWide",
+			})
+			continue
+		}
+		if frame.Rows() < 2 {
+			continue
+		}
+		filled, err := fillGaps(frame, step, opts.GapFill)
+		if err != nil {
+			return err
+		}
+		frames[i] = filled
+	}
+	return nil
+}
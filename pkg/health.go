@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gocql/gocql"
+)
+
+// healthSession returns the session of the health checks. It has its own
+// single connection per host and does not retry, so health checks repeated
+// during an outage neither take connections from the query sessions nor
+// hold the lock panels need to connect again. It authenticates with the
+// monitor credential when one is set.
+func (settings *instanceSettings) healthSession() (*gocql.Session, error) {
+	settings.healthMu.Lock()
+	defer settings.healthMu.Unlock()
+	if settings.health != nil {
+		return settings.health, nil
+	}
+	hosts := splitList(settings.settings.Host)
+	if len(hosts) == 0 {
+		return nil, errors.New("no host supplied for connection")
+	}
+	if err := settings.reserveSession(); err != nil {
+		return nil, err
+	}
+	cluster := settings.newCluster(hosts...)
+	cluster.NumConns = 1
+	cluster.RetryPolicy = nil
+	if settings.monitorAuthenticator != nil {
+		cluster.Authenticator = *settings.monitorAuthenticator
+	}
+	cluster.PoolConfig.HostSelectionPolicy = settings.hostSelectionPolicy()
+	session, err := gocql.NewSession(*cluster)
+	if err != nil {
+		settings.releaseSession()
+		return nil, settings.transportHint(err)
+	}
+	settings.health = session
+	return session, nil
+}
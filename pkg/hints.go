@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// errorHint maps driver error messages to remediation text.
+type errorHint struct {
+	matches []string
+	hint    string
+}
+
+var errorHints = []errorHint{
+	{
+		matches: []string{"authentication required"},
+		hint:    "the server requires PasswordAuthenticator; configure the user and password of the datasource",
+	},
+	{
+		matches: []string{"unexpected authenticator"},
+		hint:    "the server uses an authenticator the driver does not accept; check the authenticator configured in scylla.yaml",
+	},
+	{
+		matches: []string{"username and/or password are incorrect", "bad credentials"},
+		hint:    "the user or password is wrong; check the datasource credentials",
+	},
+	{
+		matches: []string{"unsupported protocol", "invalid or unsupported protocol version", "unable to discover protocol version"},
+		hint:    "protocol version negotiation failed; set protoVersion in the datasource settings to a version the server supports (e.g. 3 for older clusters)",
+	},
+}
+
+// remediationHint returns the remediation text for an error, or an empty
+// string when there is no known hint.
+func remediationHint(err error) string {
+	msg := strings.ToLower(err.Error())
+	for _, h := range errorHints {
+		for _, m := range h.matches {
+			if strings.Contains(msg, m) {
+				return h.hint
+			}
+		}
+	}
+	return ""
+}
+
+// withHint adds the remediation hint of an error to its message.
+func withHint(err error) error {
+	return describeError(err, "", "")
+}
+
+// Codes of the errors the server returns to a request.
+const (
+	overloadedErrorCode   = 0x1001
+	unauthorizedErrorCode = 0x2100
+	invalidErrorCode      = 0x2200
+)
+
+// describedError is a driver error with an actionable message, it unwraps
+// to the driver error.
+type describedError struct {
+	msg string
+	err error
+}
+
+func (e *describedError) Error() string {
+	return e.msg
+}
+
+func (e *describedError) Unwrap() error {
+	return e.err
+}
+
+// describeError replaces the message of the common driver errors by an
+// actionable one naming the host and keyspace involved, when they are
+// known, followed by the driver message. Other errors get their
+// remediation hint.
+func describeError(err error, host string, keyspace string) error {
+	if err == nil {
+		return nil
+	}
+	var described *describedError
+	if errors.As(err, &described) {
+		return err
+	}
+	if msg := driverErrorMessage(err, host, keyspace); msg != "" {
+		if err.Error() != "" {
+			msg = fmt.Sprintf("%s (%s)", msg, err)
+		}
+		return &describedError{msg: msg, err: err}
+	}
+	if hint := remediationHint(err); hint != "" {
+		return &describedError{msg: fmt.Sprintf("%s: %s", err, hint), err: err}
+	}
+	return err
+}
+
+// driverErrorMessage returns the actionable message of a common driver
+// error, empty for other errors.
+func driverErrorMessage(err error, host string, keyspace string) string {
+	on, in := "", ""
+	if host != "" {
+		on = " on host " + host
+	}
+	if keyspace != "" {
+		in = " in keyspace " + keyspace
+	}
+	var readTimeout *gocql.RequestErrReadTimeout
+	var unavailable *gocql.RequestErrUnavailable
+	var request gocql.RequestError
+	switch {
+	case errors.Is(err, gocql.ErrNoConnections), errors.Is(err, gocql.ErrNoConnectionsStarted):
+		return "no Scylla node is reachable" + on + ": check the host and port of the datasource, the network between Grafana and the cluster, and that the nodes are up"
+	case errors.Is(err, gocql.ErrTimeoutNoResponse):
+		return "Scylla did not answer" + on + " within the timeout: the node may be overloaded or the query may read too much, narrow the time range or raise the timeout of the datasource"
+	case errors.As(err, &readTimeout):
+		return fmt.Sprintf("the read timed out%s%s: %d of the %d replicas required at consistency %s answered, narrow the time range or the partitions read, or lower the consistency of the datasource",
+			on, in, readTimeout.Received, readTimeout.BlockFor, readTimeout.Consistency)
+	case errors.As(err, &unavailable):
+		return fmt.Sprintf("not enough replicas are alive%s%s: %d alive of the %d required at consistency %s, check that the nodes are up or lower the consistency of the datasource",
+			on, in, unavailable.Alive, unavailable.Required, unavailable.Consistency)
+	case !errors.As(err, &request):
+		return ""
+	}
+	msg := request.Message()
+	switch request.Code() {
+	case overloadedErrorCode:
+		return "Scylla is overloaded and rejected the query" + on + ": retry later, or lower the refresh rate of the dashboards or the maxConcurrentQueries of the datasource"
+	case unauthorizedErrorCode:
+		grant := "GRANT SELECT ON KEYSPACE <keyspace> TO <user>"
+		if keyspace != "" {
+			grant = "GRANT SELECT ON KEYSPACE " + keyspace + " TO <user>"
+		}
+		return "the datasource user is not allowed to run the query" + in + ": grant it the permission, e.g. " + grant
+	case invalidErrorCode:
+		lower := strings.ToLower(msg)
+		if strings.HasPrefix(lower, "unconfigured table ") {
+			return fmt.Sprintf("table %s does not exist%s: check the table name, names created with quotes are case sensitive", strings.TrimSpace(msg[len("unconfigured table "):]), in)
+		}
+		if strings.HasPrefix(lower, "keyspace ") && strings.HasSuffix(lower, " does not exist") {
+			return msg + ": check the keyspace name, names created with quotes are case sensitive"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reservedWords are the CQL reserved keywords, they must be quoted when used as identifiers.
+var reservedWords = map[string]bool{
+	"add": true, "allow": true, "alter": true, "and": true, "apply": true, "asc": true, "authorize": true,
+	"batch": true, "begin": true, "by": true, "columnfamily": true, "create": true, "delete": true,
+	"desc": true, "describe": true, "drop": true, "entries": true, "execute": true, "from": true,
+	"full": true, "grant": true, "if": true, "in": true, "index": true, "infinity": true, "insert": true,
+	"into": true, "keyspace": true, "limit": true, "modify": true, "nan": true, "norecursive": true,
+	"not": true, "null": true, "of": true, "on": true, "or": true, "order": true, "primary": true,
+	"rename": true, "replace": true, "revoke": true, "schema": true, "select": true, "set": true,
+	"table": true, "to": true, "token": true, "truncate": true, "unlogged": true, "update": true,
+	"use": true, "using": true, "view": true, "where": true, "with": true,
+}
+
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// quoteIdentifier returns the CQL form of an exact (case sensitive) name,
+// double quoted when it is mixed case, has special characters or is a reserved word.
+func quoteIdentifier(name string) string {
+	if plainIdentifier.MatchString(name) && !reservedWords[name] {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// isQuoted reports whether an identifier is double quoted.
+func isQuoted(name string) bool {
+	return len(name) > 1 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`)
+}
+
+// matchName returns the exact name an identifier refers to. Quoted
+// identifiers are exact, unquoted ones match a known name of the same case
+// (e.g. a table created with a quoted mixed case name) and otherwise follow
+// the CQL rule of being case insensitive.
+func matchName(name string, known []string) string {
+	if isQuoted(name) {
+		return strings.Replace(name[1:len(name)-1], `""`, `"`, -1)
+	}
+	for _, k := range known {
+		if k == name {
+			return k
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// nameResolver returns the exact names of the identifiers used in a
+// structured query, based on the schema metadata.
+type nameResolver interface {
+	resolveKeyspace(name string) string
+	resolveTable(keyspace string, name string) string
+	resolveColumn(keyspace string, table string, name string) string
+	columnType(keyspace string, table string, name string) string
+	functionOverloads(keyspace string, name string) []userFunction
+}
+
+func (settings *instanceSettings) resolveKeyspace(name string) string {
+	known, _ := settings.schemaKeyspaces()
+	return matchName(name, known)
+}
+
+func (settings *instanceSettings) resolveTable(keyspace string, name string) string {
+	known, _ := settings.schemaTables(keyspace)
+	return matchName(name, known)
+}
+
+func (settings *instanceSettings) resolveColumn(keyspace string, table string, name string) string {
+	columns, _ := settings.schemaColumns(keyspace, table)
+	known := make([]string, len(columns))
+	for i, c := range columns {
+		known[i] = c.Name
+	}
+	return matchName(name, known)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// maxInternedValues is the number of distinct values of a column above which
+// it is no longer considered label-like and its values are not deduplicated.
+const maxInternedValues = 1024
+
+type columnInterner struct {
+	values   map[string]string
+	disabled bool
+}
+
+// stringInterner deduplicates the string values of low cardinality columns
+// (datacenter, rack, status, ...) while a result is converted, so rows
+// share a single copy of each value. The frame itself is unchanged.
+type stringInterner struct {
+	columns map[int]*columnInterner
+	// saved is the number of bytes of the values that were deduplicated
+	saved int64
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{columns: make(map[int]*columnInterner)}
+}
+
+// intern returns the shared copy of a string value of column col.
+func (in *stringInterner) intern(col int, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	c, ok := in.columns[col]
+	if !ok {
+		c = &columnInterner{values: make(map[string]string)}
+		in.columns[col] = c
+	}
+	if c.disabled {
+		return v
+	}
+	if shared, ok := c.values[s]; ok {
+		in.saved += int64(len(s))
+		return shared
+	}
+	if len(c.values) >= maxInternedValues {
+		// a high cardinality column, keep the values as they are
+		c.disabled = true
+		c.values = nil
+		return v
+	}
+	c.values[s] = s
+	return s
+}
+
+// stats reports the memory saved by the deduplication.
+func (in *stringInterner) stats() []data.QueryStat {
+	return []data.QueryStat{{
+		FieldConfig: data.FieldConfig{DisplayName: "Deduplicated strings", Unit: "decbytes"},
+		Value:       float64(in.saved),
+	}}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// jsonPathStep matches one step of a JSON path: .key, ["key"] or [index].
+var jsonPathStep = regexp.MustCompile(`^(?:\.([a-zA-Z_][a-zA-Z0-9_]*)|\["([^"]*)"\]|\[(\d+)\])`)
+
+// jsonField extracts a value of a text column holding JSON into its own field.
+type jsonField struct {
+	Column string `json:"column"`
+	// Path is a JSONPath style expression, e.g. $.user.id or $.tags[0]
+	Path string `json:"path"`
+	// Name is the extracted field name, the column and path by default
+	Name string `json:"name"`
+}
+
+// parseJSONPath splits a path into its object keys (strings) and array indexes (ints).
+func parseJSONPath(path string) ([]interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	var steps []interface{}
+	for rest != "" {
+		m := jsonPathStep.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+		switch {
+		case m[1] != "":
+			steps = append(steps, m[1])
+		case m[3] != "":
+			i, _ := strconv.Atoi(m[3])
+			steps = append(steps, i)
+		default:
+			steps = append(steps, m[2])
+		}
+		rest = rest[len(m[0]):]
+	}
+	return steps, nil
+}
+
+// lookupJSON returns the value at the steps of a decoded JSON document.
+func lookupJSON(v interface{}, steps []interface{}) (interface{}, bool) {
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[s]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || s >= len(arr) {
+				return nil, false
+			}
+			v = arr[s]
+		}
+	}
+	return v, v != nil
+}
+
+// checkJSONFields validates the extraction specs of a query.
+func checkJSONFields(fields []jsonField) error {
+	for _, f := range fields {
+		if f.Column == "" {
+			return fmt.Errorf("JSON field %q has no column", f.Path)
+		}
+		if _, err := parseJSONPath(f.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractJSONFields appends a field per spec with the values found in the
+// JSON text of its column. Fields holding only numbers become nullable
+// float64, only booleans nullable bool, otherwise nullable strings with
+// objects and arrays encoded as JSON.
+func extractJSONFields(frame *data.Frame, fields []jsonField) error {
+	for _, spec := range fields {
+		steps, err := parseJSONPath(spec.Path)
+		if err != nil {
+			return err
+		}
+		idx := -1
+		for i, f := range frame.Fields {
+			if f.Name == spec.Column {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("JSON field column %q is not in the result", spec.Column)
+		}
+		src := frame.Fields[idx]
+		values := make([]interface{}, src.Len())
+		numbers, bools := true, true
+		for i := range values {
+			raw, ok := src.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			var doc interface{}
+			if json.Unmarshal([]byte(fmt.Sprintf("%v", raw)), &doc) != nil {
+				continue
+			}
+			if v, ok := lookupJSON(doc, steps); ok {
+				values[i] = v
+				_, isNumber := v.(float64)
+				_, isBool := v.(bool)
+				numbers, bools = numbers && isNumber, bools && isBool
+			}
+		}
+		name := spec.Name
+		if name == "" {
+			name = spec.Column + strings.TrimPrefix(spec.Path, "$")
+		}
+		frame.Fields = append(frame.Fields, jsonValuesField(name, values, numbers, bools))
+	}
+	return nil
+}
+
+func jsonValuesField(name string, values []interface{}, numbers bool, bools bool) *data.Field {
+	switch {
+	case numbers && !bools:
+		res := make([]*float64, len(values))
+		for i, v := range values {
+			if f, ok := v.(float64); ok {
+				res[i] = &f
+			}
+		}
+		return data.NewField(name, nil, res)
+	case bools && !numbers:
+		res := make([]*bool, len(values))
+		for i, v := range values {
+			if b, ok := v.(bool); ok {
+				res[i] = &b
+			}
+		}
+		return data.NewField(name, nil, res)
+	}
+	res := make([]*string, len(values))
+	for i, v := range values {
+		switch t := v.(type) {
+		case nil:
+		case string:
+			res[i] = &t
+		default:
+			b, _ := json.Marshal(t)
+			s := string(b)
+			res[i] = &s
+		}
+	}
+	return data.NewField(name, nil, res)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keyspaceFilter restricts the keyspaces a datasource instance may query.
+// When allowed is not empty only the keyspaces in it can be used, denied
+// keyspaces are always rejected.
+type keyspaceFilter struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// splitList splits a comma separated settings value, dropping empty entries.
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func toKeyspaceSet(s string) map[string]bool {
+	list := splitList(s)
+	if len(list) == 0 {
+		return nil
+	}
+	res := make(map[string]bool, len(list))
+	for _, k := range list {
+		res[normalizeIdentifier(k)] = true
+	}
+	return res
+}
+
+// normalizeIdentifier follows CQL identifier rules, unquoted names are case
+// insensitive while quoted names are kept as is.
+func normalizeIdentifier(name string) string {
+	return matchName(name, nil)
+}
+
+func newKeyspaceFilter(allowed string, denied string) *keyspaceFilter {
+	f := &keyspaceFilter{
+		allowed: toKeyspaceSet(allowed),
+		denied:  toKeyspaceSet(denied),
+	}
+	if f.allowed == nil && f.denied == nil {
+		return nil
+	}
+	return f
+}
+
+// isWordByte reports whether a byte is part of an unquoted CQL word.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// skipQuoted returns the index after the literal opened at i by quote, in
+// which a doubled quote is an escaped quote, -1 when it is not closed.
+func skipQuoted(query string, i int, quote byte) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != quote {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return -1
+}
+
+// cqlTokens splits a CQL statement into its words, quoted identifiers and
+// punctuation. Whitespace and comments (--, // and /* */) are dropped and
+// string literals are replaced by an empty literal, so their text is not taken
+// for table references. An unterminated comment, string or quoted
+// identifier is an error.
+func cqlTokens(query string) ([]string, error) {
+	var tokens []string
+	err := scanCQL(query, func(token string, start int) {
+		tokens = append(tokens, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// scanCQL calls emit with each token of cqlTokens and the offset in the
+// query it starts at.
+func scanCQL(query string, emit func(token string, start int)) error {
+	for i := 0; i < len(query); {
+		c := query[i]
+		rest := query[i:]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(rest, "--"), strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				return nil
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return errors.New("unterminated comment")
+			}
+			i += end + 4
+		case strings.HasPrefix(rest, "$$"):
+			end := strings.Index(rest[2:], "$$")
+			if end < 0 {
+				return errors.New("unterminated string")
+			}
+			emit("''", i)
+			i += end + 4
+		case c == '\'':
+			end := skipQuoted(query, i, '\'')
+			if end < 0 {
+				return errors.New("unterminated string")
+			}
+			emit("''", i)
+			i = end
+		case c == '"':
+			end := skipQuoted(query, i, '"')
+			if end < 0 {
+				return errors.New("unterminated quoted identifier")
+			}
+			emit(query[i:end], i)
+			i = end
+		case isWordByte(c):
+			end := i + 1
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			emit(query[i:end], i)
+			i = end
+		default:
+			emit(query[i:i+1], i)
+			i++
+		}
+	}
+	return nil
+}
+
+// tableKeywords are the keywords of data statements followed by a table name.
+var tableKeywords = map[string]bool{"from": true, "into": true, "update": true}
+
+// tableNameModifiers may come between the object keyword of a schema
+// statement and the object name.
+var tableNameModifiers = map[string]bool{"if": true, "not": true, "exists": true}
+
+// schemaPrefixes may come between CREATE, ALTER or DROP and the object keyword.
+var schemaPrefixes = map[string]bool{"or": true, "replace": true, "custom": true, "materialized": true}
+
+// tableReference is a table named by a statement, keyspace is empty when
+// the name is not keyspace qualified. A USE statement and statements on a
+// keyspace are a reference to the keyspace without table. Indexes, types,
+// functions and aggregates are objects of their keyspace.
+type tableReference struct {
+	keyspace string
+	table    string
+}
+
+// isIdentifierToken reports whether a token of cqlTokens is a name.
+func isIdentifierToken(t string) bool {
+	return t != "" && (isQuoted(t) || isWordByte(t[0]))
+}
+
+// skipWords returns the index of the first token from i not in words.
+func skipWords(tokens []string, i int, words map[string]bool) int {
+	for i < len(tokens) && words[strings.ToLower(tokens[i])] {
+		i++
+	}
+	return i
+}
+
+// qualifiedName parses the possibly keyspace qualified name at i and returns
+// its normalized parts and the index of the token after it.
+func qualifiedName(tokens []string, i int, what string) (string, string, int, error) {
+	if i >= len(tokens) || !isIdentifierToken(tokens[i]) {
+		return "", "", i, fmt.Errorf("can not parse the %s name", what)
+	}
+	name := normalizeIdentifier(tokens[i])
+	if i+1 < len(tokens) && tokens[i+1] == "." {
+		if i+2 >= len(tokens) || !isIdentifierToken(tokens[i+2]) {
+			return "", "", i, fmt.Errorf("can not parse the %s name", what)
+		}
+		return name, normalizeIdentifier(tokens[i+2]), i + 3, nil
+	}
+	return "", name, i + 1, nil
+}
+
+// tableAt parses the table name at i.
+func tableAt(tokens []string, i int) (tableReference, int, error) {
+	keyspace, table, next, err := qualifiedName(tokens, i, "table")
+	return tableReference{keyspace: keyspace, table: table}, next, err
+}
+
+// objectAt parses the name of the index, type, function or aggregate at i,
+// which is a reference to its keyspace.
+func objectAt(tokens []string, i int, what string) (tableReference, int, error) {
+	keyspace, _, next, err := qualifiedName(tokens, i, what)
+	return tableReference{keyspace: keyspace}, next, err
+}
+
+// keyspaceAt parses the keyspace name at i.
+func keyspaceAt(tokens []string, i int) (tableReference, int, error) {
+	keyspace, name, next, err := qualifiedName(tokens, i, "keyspace")
+	if err == nil && keyspace != "" {
+		err = errors.New("can not parse the keyspace name")
+	}
+	return tableReference{keyspace: name}, next, err
+}
+
+// dataTableRefs returns the tables after the FROM, INTO and UPDATE keywords
+// of the tokens from i.
+func dataTableRefs(tokens []string, i int) ([]tableReference, error) {
+	var refs []tableReference
+	for ; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i])
+		if !tableKeywords[keyword] {
+			continue
+		}
+		ref, next, err := tableAt(tokens, i+1)
+		if err != nil {
+			return nil, fmt.Errorf("%v after %s", err, strings.ToUpper(keyword))
+		}
+		refs = append(refs, ref)
+		i = next - 1
+	}
+	return refs, nil
+}
+
+// schemaRefs returns the references of a CREATE, ALTER or DROP statement,
+// the object it defines and the tables of its AS SELECT.
+func schemaRefs(tokens []string) ([]tableReference, error) {
+	i := skipWords(tokens, 1, schemaPrefixes)
+	if i >= len(tokens) {
+		return nil, nil
+	}
+	kind := strings.ToLower(tokens[i])
+	i = skipWords(tokens, i+1, tableNameModifiers)
+	var ref tableReference
+	var err error
+	switch kind {
+	case "keyspace", "schema":
+		ref, i, err = keyspaceAt(tokens, i)
+	case "table", "columnfamily", "view":
+		ref, i, err = tableAt(tokens, i)
+	case "index", "trigger":
+		if kind == "index" && strings.ToLower(tokens[0]) != "create" {
+			ref, i, err = objectAt(tokens, i, kind)
+			break
+		}
+		// the index or trigger name is followed by ON and the table
+		if i < len(tokens) && strings.ToLower(tokens[i]) != "on" {
+			i++
+		}
+		if i >= len(tokens) || strings.ToLower(tokens[i]) != "on" {
+			return nil, fmt.Errorf("can not parse the table of the %s", kind)
+		}
+		ref, i, err = tableAt(tokens, i+1)
+	case "type", "function", "aggregate":
+		ref, i, err = objectAt(tokens, i, kind)
+	default:
+		// roles, users and service levels are not in a keyspace
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs, err := dataTableRefs(tokens, i)
+	if err != nil {
+		return nil, err
+	}
+	return append([]tableReference{ref}, refs...), nil
+}
+
+// permissionRefs returns the resource of a GRANT, REVOKE or LIST statement,
+// named after ON. All keyspaces, roles and MBeans are no reference.
+func permissionRefs(tokens []string) ([]tableReference, error) {
+	i := 1
+	for i < len(tokens) && strings.ToLower(tokens[i]) != "on" {
+		i++
+	}
+	if i+1 >= len(tokens) {
+		return nil, nil
+	}
+	var ref tableReference
+	var err error
+	switch resource := strings.ToLower(tokens[i+1]); resource {
+	case "keyspace":
+		ref, _, err = keyspaceAt(tokens, i+2)
+	case "table", "columnfamily":
+		ref, _, err = tableAt(tokens, i+2)
+	case "function", "aggregate":
+		ref, _, err = objectAt(tokens, i+2, resource)
+	case "all":
+		// ALL FUNCTIONS IN KEYSPACE ks is the only one in a keyspace
+		for j := i + 2; j < len(tokens); j++ {
+			if strings.ToLower(tokens[j]) == "keyspace" {
+				ref, _, err = keyspaceAt(tokens, j+1)
+				if err != nil {
+					return nil, err
+				}
+				return []tableReference{ref}, nil
+			}
+		}
+		return nil, nil
+	case "role", "mbean", "mbeans":
+		return nil, nil
+	default:
+		ref, _, err = tableAt(tokens, i+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []tableReference{ref}, nil
+}
+
+// statementRefs returns the references of a single statement.
+func statementRefs(tokens []string) ([]tableReference, error) {
+	switch strings.ToLower(tokens[0]) {
+	case "use":
+		ref, _, err := keyspaceAt(tokens, 1)
+		if err != nil {
+			return nil, errors.New("can not parse the keyspace of the USE statement")
+		}
+		return []tableReference{ref}, nil
+	case "truncate":
+		ref, _, err := tableAt(tokens, skipWords(tokens, 1, map[string]bool{"table": true, "columnfamily": true}))
+		if err != nil {
+			return nil, fmt.Errorf("%v after TRUNCATE", err)
+		}
+		return []tableReference{ref}, nil
+	case "create", "alter", "drop":
+		return schemaRefs(tokens)
+	case "grant", "revoke", "list":
+		return permissionRefs(tokens)
+	}
+	return dataTableRefs(tokens, 0)
+}
+
+// queryTableRefs returns the tables, keyspaces and keyspace objects
+// referenced by the CQL statements of a query, in order, with their names
+// normalized. It fails when a name can not be parsed, so a reference is
+// never silently skipped.
+func queryTableRefs(query string) ([]tableReference, error) {
+	tokens, err := cqlTokens(query)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse the query: %v", err)
+	}
+	var refs []tableReference
+	for len(tokens) > 0 {
+		end := 0
+		for end < len(tokens) && tokens[end] != ";" {
+			end++
+		}
+		if end > 0 {
+			stmtRefs, err := statementRefs(tokens[:end])
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, stmtRefs...)
+		}
+		if end == len(tokens) {
+			break
+		}
+		tokens = tokens[end+1:]
+	}
+	return refs, nil
+}
+
+// queryKeyspaces returns the keyspaces explicitly referenced by a CQL
+// statement, none when it can not be parsed.
+func queryKeyspaces(query string) []string {
+	refs, _ := queryTableRefs(query)
+	var res []string
+	for _, ref := range refs {
+		if ref.keyspace != "" {
+			res = append(res, ref.keyspace)
+		}
+	}
+	return res
+}
+
+// checkKeyspace returns an error if the keyspace may not be queried.
+func (f *keyspaceFilter) checkKeyspace(ks string) error {
+	if f == nil {
+		return nil
+	}
+	ks = normalizeIdentifier(ks)
+	if f.denied[ks] {
+		return fmt.Errorf("access to keyspace %s is denied by the datasource configuration", ks)
+	}
+	if f.allowed != nil && !f.allowed[ks] {
+		return fmt.Errorf("keyspace %s is not in the datasource allowed keyspaces list", ks)
+	}
+	return nil
+}
+
+// check verifies that every keyspace a query touches is permitted.
+// When an allow list is configured, queries must name the keyspace of every
+// table explicitly so the check can not be bypassed. A query whose table
+// references can not be parsed, or which names none, is rejected.
+func (f *keyspaceFilter) check(query string) error {
+	if f == nil {
+		return nil
+	}
+	refs, err := queryTableRefs(query)
+	if err != nil {
+		return fmt.Errorf("query rejected, %v: the keyspaces it uses can not be checked", err)
+	}
+	if len(refs) == 0 {
+		return errors.New("query rejected: it names no keyspace or table, the keyspaces it uses can not be checked")
+	}
+	qualified := true
+	for _, ref := range refs {
+		if ref.keyspace == "" {
+			qualified = false
+			continue
+		}
+		if err := f.checkKeyspace(`"` + strings.Replace(ref.keyspace, `"`, `""`, -1) + `"`); err != nil {
+			return err
+		}
+	}
+	if !qualified && f.allowed != nil {
+		return fmt.Errorf("queries must use a keyspace qualified table name (keyspace.table) when allowed keyspaces are configured")
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCQLTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		tokens []string
+		err    bool
+	}{
+		{
+			name:   "words and punctuation",
+			query:  "SELECT a, b FROM ks.t WHERE a = 1;",
+			tokens: []string{"SELECT", "a", ",", "b", "FROM", "ks", ".", "t", "WHERE", "a", "=", "1", ";"},
+		},
+		{
+			name:   "line comments",
+			query:  "SELECT * FROM ks.t -- FROM other.t\nWHERE a = 1 // FROM other.t\n",
+			tokens: []string{"SELECT", "*", "FROM", "ks", ".", "t", "WHERE", "a", "=", "1"},
+		},
+		{
+			name:   "trailing line comment",
+			query:  "SELECT * FROM ks.t -- FROM other.t",
+			tokens: []string{"SELECT", "*", "FROM", "ks", ".", "t"},
+		},
+		{
+			name:   "block comment",
+			query:  "SELECT * /* FROM other.t; DROP TABLE x */ FROM ks.t",
+			tokens: []string{"SELECT", "*", "FROM", "ks", ".", "t"},
+		},
+		{
+			name:  "unterminated block comment",
+			query: "SELECT * FROM ks.t /* FROM other.t",
+			err:   true,
+		},
+		{
+			name:   "string literal",
+			query:  "SELECT * FROM ks.t WHERE a = 'FROM other.t; it''s'",
+			tokens: []string{"SELECT", "*", "FROM", "ks", ".", "t", "WHERE", "a", "=", "''"},
+		},
+		{
+			name:  "unterminated string literal",
+			query: "SELECT * FROM ks.t WHERE a = 'it''s",
+			err:   true,
+		},
+		{
+			name:   "dollar string",
+			query:  "SELECT * FROM ks.t WHERE a = $$FROM other.t; 'x'$$ AND b = 1",
+			tokens: []string{"SELECT", "*", "FROM", "ks", ".", "t", "WHERE", "a", "=", "''", "AND", "b", "=", "1"},
+		},
+		{
+			name:  "unterminated dollar string",
+			query: "SELECT * FROM ks.t WHERE a = $$FROM other.t",
+			err:   true,
+		},
+		{
+			name:   "quoted identifiers",
+			query:  `SELECT "My ""Col""" FROM "Ks"."T;--"`,
+			tokens: []string{"SELECT", `"My ""Col"""`, "FROM", `"Ks"`, ".", `"T;--"`},
+		},
+		{
+			name:  "unterminated quoted identifier",
+			query: `SELECT * FROM "ks.t`,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := cqlTokens(tt.query)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got tokens %q", tokens)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tokens, tt.tokens) {
+				t.Errorf("got %q, want %q", tokens, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestScanCQLOffsets(t *testing.T) {
+	query := "SELECT 'x' FROM \"Ks\".t"
+	var starts []int
+	err := scanCQL(query, func(token string, start int) {
+		starts = append(starts, start)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{0, 7, 11, 16, 20, 21}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("got %v, want %v", starts, want)
+	}
+}
+
+func TestQueryTableRefs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		refs  []tableReference
+		err   bool
+	}{
+		{
+			name:  "select",
+			query: "SELECT * FROM KS.Events WHERE a = 1",
+			refs:  []tableReference{{keyspace: "ks", table: "events"}},
+		},
+		{
+			name:  "unqualified table",
+			query: "SELECT * FROM events",
+			refs:  []tableReference{{table: "events"}},
+		},
+		{
+			name:  "quoted identifiers keep their case",
+			query: `SELECT * FROM "My""Ks"."Events"`,
+			refs:  []tableReference{{keyspace: `My"Ks`, table: "Events"}},
+		},
+		{
+			name:  "tables in comments and literals are ignored",
+			query: "SELECT * FROM ks.t /* FROM other.t */ WHERE a = 'FROM other.t' AND b = $$FROM other.t$$ -- FROM other.t",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "several statements",
+			query: "SELECT * FROM ks.a; SELECT * FROM other.b",
+			refs:  []tableReference{{keyspace: "ks", table: "a"}, {keyspace: "other", table: "b"}},
+		},
+		{
+			name:  "use",
+			query: "USE Ks; SELECT * FROM t",
+			refs:  []tableReference{{keyspace: "ks"}, {table: "t"}},
+		},
+		{
+			name:  "use without a keyspace",
+			query: "USE ;",
+			err:   true,
+		},
+		{
+			name:  "batch",
+			query: "BEGIN BATCH INSERT INTO ks.a (k) VALUES (1); UPDATE other.b SET v = 1 WHERE k = 1; DELETE FROM third.c WHERE k = 1; APPLY BATCH",
+			refs:  []tableReference{{keyspace: "ks", table: "a"}, {keyspace: "other", table: "b"}, {keyspace: "third", table: "c"}},
+		},
+		{
+			name:  "truncate",
+			query: "TRUNCATE TABLE ks.t",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "create table",
+			query: "CREATE TABLE IF NOT EXISTS ks.t (k int PRIMARY KEY)",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "create materialized view",
+			query: "CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM other.t WHERE k IS NOT NULL PRIMARY KEY (k)",
+			refs:  []tableReference{{keyspace: "ks", table: "v"}, {keyspace: "other", table: "t"}},
+		},
+		{
+			name:  "create index",
+			query: "CREATE INDEX idx ON ks.t (v)",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "drop keyspace",
+			query: "DROP KEYSPACE IF EXISTS ks",
+			refs:  []tableReference{{keyspace: "ks"}},
+		},
+		{
+			name:  "create role",
+			query: "CREATE ROLE reader WITH PASSWORD = 'x'",
+		},
+		{
+			name:  "grant on a table",
+			query: "GRANT SELECT ON ks.t TO reader",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "grant on a keyspace",
+			query: "GRANT MODIFY ON KEYSPACE Ks TO writer",
+			refs:  []tableReference{{keyspace: "ks"}},
+		},
+		{
+			name:  "grant on all keyspaces",
+			query: "GRANT SELECT ON ALL KEYSPACES TO reader",
+		},
+		{
+			name:  "revoke on the functions of a keyspace",
+			query: "REVOKE EXECUTE ON ALL FUNCTIONS IN KEYSPACE ks FROM reader",
+			refs:  []tableReference{{keyspace: "ks"}},
+		},
+		{
+			name:  "list on a table",
+			query: "LIST ALL PERMISSIONS ON TABLE ks.t",
+			refs:  []tableReference{{keyspace: "ks", table: "t"}},
+		},
+		{
+			name:  "missing table name",
+			query: "SELECT * FROM",
+			err:   true,
+		},
+		{
+			name:  "unterminated literal",
+			query: "SELECT * FROM ks.t WHERE a = 'x",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := queryTableRefs(tt.query)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got references %v", refs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(refs, tt.refs) {
+				t.Errorf("got %v, want %v", refs, tt.refs)
+			}
+		})
+	}
+}
+
+func TestKeyspaceFilterCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		denied  string
+		query   string
+		err     bool
+	}{
+		{name: "allowed", allowed: "ks", query: "SELECT * FROM ks.t"},
+		{name: "not allowed", allowed: "ks", query: "SELECT * FROM other.t", err: true},
+		{name: "unqualified with an allow list", allowed: "ks", query: "SELECT * FROM t", err: true},
+		{name: "denied", denied: "system_auth", query: "SELECT * FROM system_auth.roles", err: true},
+		{name: "denied in a second statement", denied: "secret", query: "SELECT * FROM ks.t; SELECT * FROM secret.t", err: true},
+		{name: "denied in a batch", denied: "secret", query: "BEGIN BATCH INSERT INTO ks.t (k) VALUES (1); INSERT INTO secret.t (k) VALUES (1); APPLY BATCH", err: true},
+		{name: "denied by use", denied: "secret", query: "USE secret", err: true},
+		{name: "denied by grant", denied: "secret", query: "GRANT SELECT ON KEYSPACE secret TO reader", err: true},
+		{name: "denied in a comment only", denied: "secret", query: "SELECT * FROM ks.t -- secret.t"},
+		{name: "quoted name of a denied keyspace", denied: "secret", query: `SELECT * FROM "secret".t`, err: true},
+		{name: "quoted name of another keyspace", denied: "secret", query: `SELECT * FROM "Secret".t`},
+		{name: "no table", denied: "secret", query: "SELECT now() FROM", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newKeyspaceFilter(tt.allowed, tt.denied).check(tt.query)
+			if tt.err && err == nil {
+				t.Errorf("expected %q to be rejected", tt.query)
+			}
+			if !tt.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultLatencyProbeInterval is how often the contact point latencies are
+// measured again.
+const defaultLatencyProbeInterval = 5 * time.Minute
+
+// sessionDrainDelay is how long a replaced session stays open for the queries
+// still running on it.
+const sessionDrainDelay = time.Minute
+
+// latencyProbeTimeout bounds the measure of a single contact point.
+const latencyProbeTimeout = 2 * time.Second
+
+// contactPointLatency is the measured round trip time to a contact point,
+// shown in /debug/state.
+type contactPointLatency struct {
+	Host      string        `json:"host"`
+	RTT       time.Duration `json:"rtt"`
+	Reachable bool          `json:"reachable"`
+}
+
+// contactPoints orders the configured contact points by measured latency.
+type contactPoints struct {
+	mu       sync.Mutex
+	hosts    []string
+	interval time.Duration
+	ordered  []contactPointLatency
+	stop     chan struct{}
+}
+
+func newContactPoints(hosts []string, interval time.Duration) *contactPoints {
+	return &contactPoints{hosts: hosts, interval: interval}
+}
+
+// measureRTT returns the time it takes to open a TCP connection to a host.
+func measureRTT(host string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, defaultCQLPort)
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", host, latencyProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+// measure measures the latency to every contact point, fastest first and
+// unreachable ones last.
+func (c *contactPoints) measure() []contactPointLatency {
+	res := make([]contactPointLatency, len(c.hosts))
+	var wg sync.WaitGroup
+	for i, host := range c.hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			rtt, err := measureRTT(host)
+			res[i] = contactPointLatency{Host: host, RTT: rtt, Reachable: err == nil}
+		}(i, host)
+	}
+	wg.Wait()
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Reachable != res[j].Reachable {
+			return res[i].Reachable
+		}
+		return res[i].RTT < res[j].RTT
+	})
+	c.mu.Lock()
+	c.ordered = res
+	c.mu.Unlock()
+	return res
+}
+
+// fastest returns the reachable contact point with the lowest latency, none
+// until the latencies were measured once.
+func (c *contactPoints) fastest() (string, bool) {
+	if c == nil || len(c.hosts) < 2 {
+		return "", false
+	}
+	c.mu.Lock()
+	ordered := c.ordered
+	c.mu.Unlock()
+	if len(ordered) == 0 || !ordered[0].Reachable {
+		return "", false
+	}
+	return ordered[0].Host, true
+}
+
+// watch measures the latencies in the background, right away and then every
+// interval, and calls changed when the fastest contact point is another
+// one, until close is called. A zero interval measures them once.
+func (c *contactPoints) watch(changed func(fastest string)) {
+	if c == nil || len(c.hosts) < 2 {
+		return
+	}
+	c.stop = make(chan struct{})
+	go func() {
+		var tick <-chan time.Time
+		if c.interval > 0 {
+			ticker := time.NewTicker(c.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			before, _ := c.fastest()
+			c.measure()
+			if after, ok := c.fastest(); ok && after != before {
+				changed(after)
+			}
+			if tick == nil {
+				return
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-tick:
+			}
+		}
+	}()
+}
+
+// close stops measuring the latencies.
+func (c *contactPoints) close() {
+	if c != nil && c.stop != nil {
+		close(c.stop)
+	}
+}
+
+// latencies returns the last measured latencies without measuring them.
+func (c *contactPoints) latencies() []contactPointLatency {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ordered
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// monitoringLink is a link template to a Scylla Monitoring dashboard, the
+// ${cluster}, ${keyspace} and ${table} placeholders are replaced with the
+// cluster and the table a query reads.
+type monitoringLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// checkMonitoringLinks validates the monitoringLinks setting.
+func checkMonitoringLinks(links []monitoringLink) error {
+	for i, l := range links {
+		if l.Title == "" || l.URL == "" {
+			return fmt.Errorf("monitoring link %d requires a title and a url", i+1)
+		}
+		if _, err := url.Parse(expandLink(l.URL, "cluster", "keyspace", "table")); err != nil {
+			return fmt.Errorf("monitoring link %d has an invalid url: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// expandLink replaces the placeholders of a link template with their
+// escaped values.
+func expandLink(template string, cluster string, keyspace string, table string) string {
+	return strings.NewReplacer(
+		"${cluster}", url.QueryEscape(cluster),
+		"${keyspace}", url.QueryEscape(keyspace),
+		"${table}", url.QueryEscape(table),
+	).Replace(template)
+}
+
+// clusterName returns the name of the connected cluster, empty when it can not be read.
+func (settings *instanceSettings) clusterName() string {
+	v, err := settings.schema.get("cluster_name", func() (interface{}, error) {
+		session, err := settings.getSession("")
+		if err != nil {
+			return nil, err
+		}
+		var name string
+		if err := session.Query("SELECT cluster_name FROM system.local").Scan(&name); err != nil {
+			return nil, err
+		}
+		return name, nil
+	})
+	if err != nil {
+		return ""
+	}
+	return v.(string)
+}
+
+// addMonitoringLinks links the fields of the frames of a query reading a
+// keyspace qualified table to the monitoring dashboards of the table. The
+// links are also listed in the query metadata.
+func (settings *instanceSettings) addMonitoringLinks(frames []*data.Frame) {
+	if len(settings.settings.MonitoringLinks) == 0 {
+		return
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		refs, _ := queryTableRefs(frame.Meta.ExecutedQueryString)
+		if len(refs) == 0 || refs[0].keyspace == "" || refs[0].table == "" {
+			continue
+		}
+		ref := refs[0]
+		cluster := settings.clusterName()
+		links := make([]data.DataLink, len(settings.settings.MonitoringLinks))
+		for i, l := range settings.settings.MonitoringLinks {
+			links[i] = data.DataLink{Title: l.Title, URL: expandLink(l.URL, cluster, ref.keyspace, ref.table), TargetBlank: true}
+		}
+		for _, field := range frame.Fields {
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.Links = append(field.Config.Links, links...)
+		}
+		if meta, ok := frame.Meta.Custom.(queryMeta); ok {
+			meta.Links = links
+			frame.Meta.Custom = meta
+		}
+	}
+}
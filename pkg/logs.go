@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// logsFormat is the query format returning a frame for the Logs panel and
+// the Explore logs view.
+const logsFormat = "logs"
+
+// logsMapping maps the result columns to the parts of a log line. Unset
+// columns default to the first time column for the timestamp, a level or
+// severity column for the level and the first other text column for the body.
+type logsMapping struct {
+	Timestamp string   `json:"timestamp"`
+	Body      string   `json:"body"`
+	Level     string   `json:"level"`
+	Labels    []string `json:"labels"`
+}
+
+func fieldIndex(frame *data.Frame, name string) int {
+	for i, f := range frame.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func isTimeField(f *data.Field) bool {
+	return f.Type() == data.FieldTypeTime || f.Type() == data.FieldTypeNullableTime
+}
+
+func isStringField(f *data.Field) bool {
+	return f.Type() == data.FieldTypeString || f.Type() == data.FieldTypeNullableString
+}
+
+// logsFrame returns the frame with the timestamp, body and level fields
+// first, followed by the label fields, newest lines first. Grafana reads
+// the level from the field named level, the label fields are shown as
+// the fields of each line.
+func logsFrame(frame *data.Frame, m logsMapping) (*data.Frame, error) {
+	lookup := func(part string, name string, match func(*data.Field) bool) (int, error) {
+		if name != "" {
+			idx := fieldIndex(frame, name)
+			if idx < 0 {
+				return -1, fmt.Errorf("logs %s column %s is not in the result", part, name)
+			}
+			return idx, nil
+		}
+		for i, f := range frame.Fields {
+			if match(f) {
+				return i, nil
+			}
+		}
+		return -1, nil
+	}
+	ts, err := lookup("timestamp", m.Timestamp, isTimeField)
+	if err != nil {
+		return nil, err
+	}
+	if ts < 0 {
+		return nil, errors.New("the logs format requires a time column")
+	}
+	level, err := lookup("level", m.Level, func(f *data.Field) bool {
+		return isStringField(f) && (f.Name == "level" || f.Name == "severity")
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, err := lookup("body", m.Body, func(f *data.Field) bool {
+		return isStringField(f) && fieldIndex(frame, f.Name) != level && !containsString(m.Labels, f.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if body < 0 {
+		return nil, errors.New("the logs format requires a text column for the log body")
+	}
+	fields := []*data.Field{frame.Fields[ts], frame.Fields[body]}
+	if level >= 0 {
+		frame.Fields[level].Name = "level"
+		fields = append(fields, frame.Fields[level])
+	}
+	for _, name := range m.Labels {
+		idx := fieldIndex(frame, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("logs label column %s is not in the result", name)
+		}
+		if idx != ts && idx != body && idx != level {
+			fields = append(fields, frame.Fields[idx])
+		}
+	}
+	res := data.NewFrame(frame.Name, fields...)
+	res.RefID = frame.RefID
+	res.Meta = frame.Meta
+	if res.Meta == nil {
+		res.Meta = &data.FrameMeta{}
+	}
+	res.Meta.PreferredVisualization = data.VisTypeLogs
+
+	// newest lines first, lines without a timestamp last
+	timeField := frame.Fields[ts]
+	rows := make([]int, timeField.Len())
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		ti, iok := timeAt(timeField, rows[i])
+		tj, jok := timeAt(timeField, rows[j])
+		if !iok || !jok {
+			return iok && !jok
+		}
+		return ti.After(tj)
+	})
+	return reorderRows(res, rows), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	timeFilterMacro = regexp.MustCompile(`\$__timeFilter\(\s*([^)\s]+)\s*\)`)
+	simpleMacro     = regexp.MustCompile(`\$__(timeFrom|timeTo|unixEpochFrom|unixEpochTo|interval_ms)\b`)
+	// secureVariable matches the names of variables whose values are not echoed back:
+	// names such as password or token, or ending in _password, _secret or _token.
+	secureVariable = regexp.MustCompile(`(?i)^(pass|passwd|password|secret|token|api_?key|credentials?)$|_(password|secret|token)$`)
+)
+
+// expandMacros replaces the time macros in a CQL query and returns the
+// expanded query together with the value each used macro expanded to.
+//
+// Supported macros:
+//  $__timeFilter(column) - column >= from AND column <= to
+//  $__timeFrom, $__timeTo - the time range in epoch milliseconds
+//  $__unixEpochFrom, $__unixEpochTo - the time range in epoch seconds
+//  $__interval_ms - the query interval in milliseconds
+func expandMacros(query string, q backend.DataQuery) (string, map[string]string) {
+	from := q.TimeRange.From.UnixNano() / 1e6
+	to := q.TimeRange.To.UnixNano() / 1e6
+	values := map[string]string{
+		"timeFrom":      strconv.FormatInt(from, 10),
+		"timeTo":        strconv.FormatInt(to, 10),
+		"unixEpochFrom": strconv.FormatInt(q.TimeRange.From.Unix(), 10),
+		"unixEpochTo":   strconv.FormatInt(q.TimeRange.To.Unix(), 10),
+		"interval_ms":   strconv.FormatInt(q.Interval.Milliseconds(), 10),
+	}
+	used := make(map[string]string)
+	query = timeFilterMacro.ReplaceAllStringFunc(query, func(m string) string {
+		column := timeFilterMacro.FindStringSubmatch(m)[1]
+		res := fmt.Sprintf("%s >= %d AND %s <= %d", column, from, column, to)
+		used[strings.TrimPrefix(m, "$")] = res
+		return res
+	})
+	query = simpleMacro.ReplaceAllStringFunc(query, func(m string) string {
+		name := strings.TrimPrefix(m, "$__")
+		used["__"+name] = values[name]
+		return values[name]
+	})
+	return query, used
+}
+
+// queryMeta is the frame custom metadata describing how a query was
+// executed, it is shown in the query inspector.
+type queryMeta struct {
+	TimeRange   *metaTimeRange    `json:"timeRange,omitempty"`
+	Macros      map[string]string `json:"macros,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	BoundValues []interface{}     `json:"boundValues,omitempty"`
+	// Reversed is set when the rows of a descending clustering order were put in ascending time order
+	Reversed bool `json:"reversed,omitempty"`
+	// Traces are the query traces of a query run with tracing, one per page
+	Traces []queryTrace `json:"traces,omitempty"`
+	// Links are the monitoring dashboards of the table a query reads
+	Links []data.DataLink `json:"links,omitempty"`
+	// CustomPayload is the custom payload of the responses of a query run with customPayload
+	CustomPayload customPayloads `json:"customPayload,omitempty"`
+	// Errors are the errors of the hosts that failed of a query run on several queryHost hosts
+	Errors []subQueryError `json:"errors,omitempty"`
+}
+
+type metaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// redactVariables returns the template variables the frontend replaced,
+// hiding the values of variables that look like they hold secrets.
+func redactVariables(variables map[string]string) map[string]string {
+	if len(variables) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(variables))
+	for name, value := range variables {
+		if secureVariable.MatchString(name) {
+			value = "<redacted>"
+		}
+		res[name] = value
+	}
+	return res
+}
+
+// redactQuery hides the values of the variables redactVariables hides in the
+// executed query, the frontend substituted them into the query text.
+func redactQuery(query string, variables map[string]string) string {
+	for name, value := range variables {
+		if value != "" && secureVariable.MatchString(name) {
+			query = strings.ReplaceAll(query, value, "<redacted>")
+		}
+	}
+	return query
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultIdleTimeout is how long an instance is unused before its sessions
+// and caches are released when idleTimeout is not set.
+const defaultIdleTimeout = 30 * time.Minute
+
+// defaultMemoryBudgetMB is the memory budget of an instance when memoryBudgetMB is not set.
+const defaultMemoryBudgetMB = 64
+
+// maxMemoryBudgetMB bounds the memoryBudgetMB setting.
+const maxMemoryBudgetMB = 4096
+
+// reclaimInterval is how often the instances are checked for idleness and
+// memory pressure.
+const reclaimInterval = time.Minute
+
+// Estimates of the memory held by the parts of an instance that are not
+// measured: a schema cache entry, a driver connection with its buffers and
+// goroutines, and a recent error.
+const (
+	schemaEntryBytes = 4 << 10
+	connectionBytes  = 128 << 10
+	recentErrorBytes = 512
+)
+
+var (
+	memoryBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scylla_datasource",
+		Name:      "memory_bytes",
+		Help:      "The estimated memory held by the caches and sessions of the datasource.",
+	}, []string{"datasource"})
+	evictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scylla_datasource",
+		Name:      "evictions_total",
+		Help:      "The number of times the sessions or caches of the datasource were released, because it was idle or over its memory budget.",
+	}, []string{"datasource", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(memoryBytes, evictions)
+}
+
+// liveInstances are the instances of the plugin process, checked every
+// reclaimInterval.
+var liveInstances = struct {
+	sync.Mutex
+	set  map[*instanceSettings]struct{}
+	once sync.Once
+}{set: make(map[*instanceSettings]struct{})}
+
+// registerInstance adds an instance to the reclaimed instances.
+func registerInstance(settings *instanceSettings) {
+	settings.touch()
+	liveInstances.Lock()
+	liveInstances.set[settings] = struct{}{}
+	liveInstances.Unlock()
+	liveInstances.once.Do(func() {
+		go func() {
+			for range time.Tick(reclaimInterval) {
+				reclaimInstances(time.Now())
+			}
+		}()
+	})
+}
+
+// unregisterInstance removes a disposed instance and its log secrets.
+func unregisterInstance(settings *instanceSettings) {
+	liveInstances.Lock()
+	delete(liveInstances.set, settings)
+	liveInstances.Unlock()
+	memoryBytes.DeleteLabelValues(settings.name)
+	unregisterSecrets(settings.secrets)
+}
+
+func reclaimInstances(now time.Time) {
+	liveInstances.Lock()
+	instances := make([]*instanceSettings, 0, len(liveInstances.set))
+	for settings := range liveInstances.set {
+		instances = append(instances, settings)
+	}
+	liveInstances.Unlock()
+	for _, settings := range instances {
+		settings.reclaim(now)
+	}
+}
+
+// touch records that the instance is used.
+func (settings *instanceSettings) touch() {
+	atomic.StoreInt64(&settings.lastUsed, time.Now().UnixNano())
+}
+
+// memoryUsage is the estimated memory held by an instance, shown in /debug/state.
+type memoryUsage struct {
+	ResultCache int64 `json:"resultCache"`
+	SchemaCache int64 `json:"schemaCache"`
+	Sessions    int64 `json:"sessions"`
+	Errors      int64 `json:"errors"`
+	Total       int64 `json:"total"`
+	Budget      int64 `json:"budget"`
+}
+
+// memoryUsage estimates the memory held by the caches, the sessions and the
+// recent errors of the instance.
+func (settings *instanceSettings) memoryUsage() memoryUsage {
+	usage := memoryUsage{Budget: settings.options.memoryBudget}
+	if stats := settings.results.stats(); stats != nil {
+		usage.ResultCache = stats.Bytes
+	}
+	usage.SchemaCache = int64(settings.schema.size()) * schemaEntryBytes
+	settings.mu.Lock()
+	sessions := len(settings.sessions)
+	settings.mu.Unlock()
+	settings.healthMu.Lock()
+	if settings.health != nil {
+		sessions++
+	}
+	settings.healthMu.Unlock()
+	conns := settings.options.numConns
+	if conns == 0 {
+		conns = 2
+	}
+	hosts := len(splitList(settings.settings.Host))
+	if hosts == 0 {
+		hosts = 1
+	}
+	usage.Sessions = int64(sessions*conns*hosts) * connectionBytes
+	usage.Errors = int64(len(settings.errors.list())) * recentErrorBytes
+	usage.Total = usage.ResultCache + usage.SchemaCache + usage.Sessions + usage.Errors
+	return usage
+}
+
+// reclaim releases the sessions and caches of an instance idle for
+// idleTimeout, running no query nor resource call, the sessions are opened
+// again by the next query, and
+// shrinks the caches of an instance over its memory budget: the least
+// recently used results first, then the schema cache.
+func (settings *instanceSettings) reclaim(now time.Time) {
+	idle := now.Sub(time.Unix(0, atomic.LoadInt64(&settings.lastUsed)))
+	if timeout := settings.options.idleTimeout; timeout > 0 && idle > timeout && settings.running.idle() {
+		if usage := settings.memoryUsage(); usage.Sessions+usage.ResultCache+usage.SchemaCache > 0 && settings.closeIdleSessions() {
+			log.DefaultLogger.Debug("Released the sessions and caches of an idle datasource", "datasource", settings.name, "idle", idle)
+			settings.results.shrink(0)
+			settings.schema.invalidate()
+			evictions.WithLabelValues(settings.name, "idle").Inc()
+		}
+	}
+	usage := settings.memoryUsage()
+	if usage.Budget > 0 && usage.Total > usage.Budget {
+		log.DefaultLogger.Info("Datasource over its memory budget, shrinking its caches", "datasource", settings.name, "bytes", usage.Total, "budget", usage.Budget)
+		settings.results.shrink(usage.Budget - (usage.Total - usage.ResultCache))
+		if usage = settings.memoryUsage(); usage.Total > usage.Budget {
+			settings.schema.invalidate()
+		}
+		evictions.WithLabelValues(settings.name, "memory").Inc()
+		usage = settings.memoryUsage()
+	}
+	memoryBytes.WithLabelValues(settings.name).Set(float64(usage.Total))
+}
+
+// closeIdleSessions closes the sessions of the instance unless a query or a
+// resource call is running. The check is made under settings.mu, the lock
+// getSession takes: a query started before it keeps the sessions open, one
+// started after it waits for them to be closed and opens a new one.
+func (settings *instanceSettings) closeIdleSessions() bool {
+	settings.mu.Lock()
+	if !settings.running.idle() {
+		settings.mu.Unlock()
+		return false
+	}
+	settings.closeQuerySessions()
+	settings.mu.Unlock()
+	settings.closeHealthSession()
+	return true
+}
+
+// framesBytes estimates the memory held by the values of frames.
+func framesBytes(frames []*data.Frame) int64 {
+	var n int64
+	for _, frame := range frames {
+		for _, f := range frame.Fields {
+			switch f.Type() {
+			case data.FieldTypeString, data.FieldTypeNullableString:
+				for i := 0; i < f.Len(); i++ {
+					if v, ok := f.ConcreteAt(i); ok {
+						n += int64(len(v.(string)))
+					}
+					n += 16
+				}
+			default:
+				n += int64(f.Len()) * 16
+			}
+		}
+	}
+	return n
+}
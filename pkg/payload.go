@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/base64"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gocql/gocql"
+)
+
+// customPayloads collects the custom payloads of the response pages of a
+// query, the values of each key in page order. Text values are kept as
+// is, binary ones are base64 encoded.
+type customPayloads map[string][]string
+
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// iterPayload returns the custom payload of the current page of an iterator.
+// The driver does not check whether a failed iterator has a response.
+func iterPayload(iter *gocql.Iter) (payload map[string][]byte) {
+	defer func() {
+		if recover() != nil {
+			payload = nil
+		}
+	}()
+	return iter.GetCustomPayload()
+}
+
+// add records the custom payload of the current page of an iterator.
+func (p customPayloads) add(iter *gocql.Iter) {
+	for k, v := range iterPayload(iter) {
+		if isText(v) {
+			p[k] = append(p[k], string(v))
+		} else {
+			p[k] = append(p[k], base64.StdEncoding.EncodeToString(v))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// queryRules are the admin configured rules every query is checked against
+// before it is executed.
+type queryRules struct {
+	allow         []*regexp.Regexp
+	deny          []*regexp.Regexp
+	allowedTables map[string]bool
+	deniedTables  map[string]bool
+}
+
+func compilePatterns(kind string, patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", kind, p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// normalizeTable returns the keyspace.table form of a table reference.
+func normalizeTable(ref string) string {
+	parts := strings.SplitN(ref, ".", 2)
+	for i := range parts {
+		parts[i] = normalizeIdentifier(strings.TrimSpace(parts[i]))
+	}
+	return strings.Join(parts, ".")
+}
+
+func toTableSet(s string) map[string]bool {
+	list := splitList(s)
+	if len(list) == 0 {
+		return nil
+	}
+	res := make(map[string]bool, len(list))
+	for _, t := range list {
+		res[normalizeTable(t)] = true
+	}
+	return res
+}
+
+func newQueryRules(settings editModel) (*queryRules, error) {
+	allow, err := compilePatterns("queryAllowPatterns", settings.QueryAllowPatterns)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compilePatterns("queryDenyPatterns", settings.QueryDenyPatterns)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range splitList(settings.AllowedTables + "," + settings.DeniedTables) {
+		if !strings.Contains(t, ".") {
+			return nil, fmt.Errorf("table %q must be keyspace qualified (keyspace.table)", t)
+		}
+	}
+	rules := &queryRules{
+		allow:         allow,
+		deny:          deny,
+		allowedTables: toTableSet(settings.AllowedTables),
+		deniedTables:  toTableSet(settings.DeniedTables),
+	}
+	if len(rules.allow) == 0 && len(rules.deny) == 0 && rules.allowedTables == nil && rules.deniedTables == nil {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// check returns an error explaining why a query is rejected, nil when it may run.
+func (r *queryRules) check(query string) error {
+	if r == nil {
+		return nil
+	}
+	for _, re := range r.deny {
+		if re.MatchString(query) {
+			return fmt.Errorf("query rejected: it matches the denied pattern %q", re.String())
+		}
+	}
+	if len(r.allow) > 0 {
+		allowed := false
+		for _, re := range r.allow {
+			if re.MatchString(query) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("query rejected: it does not match any of the allowed query patterns")
+		}
+	}
+	if r.allowedTables == nil && r.deniedTables == nil {
+		return nil
+	}
+	refs, err := queryTableRefs(query)
+	if err != nil {
+		return fmt.Errorf("query rejected, %v: the tables it uses can not be checked", err)
+	}
+	for _, ref := range refs {
+		if ref.table == "" {
+			continue
+		}
+		if ref.keyspace == "" {
+			if r.allowedTables != nil {
+				return fmt.Errorf("query rejected: table %s must be keyspace qualified when allowed tables are configured", ref.table)
+			}
+			continue
+		}
+		table := ref.keyspace + "." + ref.table
+		if r.deniedTables[table] {
+			return fmt.Errorf("query rejected: access to table %s is denied", table)
+		}
+		if r.allowedTables != nil && !r.allowedTables[table] {
+			return fmt.Errorf("query rejected: table %s is not in the allowed tables", table)
+		}
+	}
+	return nil
+}
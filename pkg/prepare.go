@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// errorPosition matches the "line 1:14" position of CQL syntax errors.
+var errorPosition = regexp.MustCompile(`line (\d+):(\d+)`)
+
+// queryValidation is the response of /validate.
+type queryValidation struct {
+	Valid bool `json:"valid"`
+	// Query is the statement that was prepared, after macro expansion and rewrites
+	Query string `json:"query,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Code is the CQL error code, e.g. 8192 for syntax errors and 8704 for invalid queries
+	Code   int `json:"code,omitempty"`
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// prepareError describes why a statement could not be prepared.
+func prepareError(query string, err error) queryValidation {
+	res := queryValidation{Query: query, Error: err.Error()}
+	if reqErr, ok := err.(gocql.RequestError); ok {
+		res.Code = reqErr.Code()
+		res.Error = reqErr.Message()
+	}
+	if m := errorPosition.FindStringSubmatch(res.Error); m != nil {
+		res.Line, _ = strconv.Atoi(m[1])
+		res.Column, _ = strconv.Atoi(m[2])
+	}
+	return res
+}
+
+// prepareStatement prepares a statement on a coordinator without executing
+// it, the driver prepares statements to compute their routing key.
+func prepareStatement(q *gocql.Query) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		// the statement was prepared, building the routing key of a statement
+		// with unbound partition key markers indexes past its values afterwards
+		if rerr, ok := r.(runtime.Error); ok && strings.Contains(rerr.Error(), "index out of range") {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("preparing the statement failed: %v", r)
+	}()
+	_, err = q.GetRoutingKey()
+	if _, ok := err.(gocql.MarshalError); ok {
+		return nil
+	}
+	return err
+}
+
+// handleValidateQuery prepares the query posted in the request body without
+// executing it, so the editor can show syntax and schema errors before a
+// broken panel is saved.
+func (td *SampleDatasource) handleValidateQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST with the query as the body"))
+		return
+	}
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := time.Now()
+	query, _ := expandMacros(string(body), backend.DataQuery{
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+	})
+	query = rewriteQuery(query, instance.rewrites)
+	if err := instance.checkQuery(query); err != nil {
+		writeJSON(w, http.StatusOK, queryValidation{Query: query, Error: err.Error()})
+		return
+	}
+	session, err := instance.getSession("")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, withHint(err))
+		return
+	}
+	if err := prepareStatement(session.Query(query).WithContext(r.Context())); err != nil {
+		if _, ok := err.(gocql.RequestError); !ok {
+			writeError(w, http.StatusInternalServerError, withHint(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, prepareError(query, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, queryValidation{Valid: true, Query: query})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// checkQueryLogLevel validates the queryLogLevel setting: debug, the
+// default, info or off.
+func checkQueryLogLevel(level string) error {
+	switch level {
+	case "", "debug", "info", "off":
+		return nil
+	}
+	return fmt.Errorf("unknown queryLogLevel %q, use debug, info or off", level)
+}
+
+// coordinator returns the address of the host that coordinated a query,
+// the host the query was sent to when the driver does not know it.
+func coordinator(iter *gocql.Iter, host string) string {
+	if h := iter.Host(); h != nil {
+		return h.HostnameAndPort()
+	}
+	return host
+}
+
+// logQuery logs an executed query with its duration and the rows it
+// returned, at the queryLogLevel of the datasource.
+func (settings *instanceSettings) logQuery(refID string, host string, query string, duration time.Duration, rows int, err error) {
+	args := []interface{}{"datasource", settings.name, "refId", refID, "host", host, "query", query, "duration", duration, "rows", rows}
+	if err != nil {
+		args = append(args, "err", err)
+	}
+	switch settings.settings.QueryLogLevel {
+	case "off":
+	case "info":
+		log.DefaultLogger.Info("Query executed", args...)
+	default:
+		log.DefaultLogger.Debug("Query executed", args...)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// queryModelSchema is the public JSON Schema of the query model. Properties
+// Grafana adds to every query (refId, datasource, ...) are allowed.
+const queryModelSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "scylla-datasource/query.schema.json",
+  "title": "Scylla datasource query",
+  "type": "object",
+  "properties": {
+    "queryText": {"type": "string", "description": "The CQL query, macros and template variables are expanded"},
+    "queryHost": {"type": "string", "description": "Comma separated hosts the query is sent to, each adds a _host field"},
+    "queryType": {"type": "string", "enum": ["", "clients", "caches", "protocol_servers", "keyspaces", "tables", "columns", "query", "distinct", "cdc", "count", "trace"]},
+    "format": {"type": "string", "enum": ["", "table", "time_series", "logs"]},
+    "editorMode": {"type": "string", "enum": ["", "code", "builder"]},
+    "builder": {
+      "type": "object",
+      "properties": {
+        "keyspace": {"type": "string"},
+        "table": {"type": "string"},
+        "columns": {"type": "array", "items": {"type": "string"}},
+        "functions": {
+          "type": "array",
+          "description": "User defined functions and aggregates applied to columns",
+          "items": {
+            "type": "object",
+            "properties": {
+              "function": {"type": "string"},
+              "args": {"type": "array", "items": {"type": "string"}},
+              "alias": {"type": "string"}
+            },
+            "required": ["function"],
+            "additionalProperties": false
+          }
+        },
+        "timeColumn": {"type": "string"},
+        "timeUnit": {"type": "string", "enum": ["", "s", "ms", "us", "ns"]},
+        "where": {"type": "string"},
+        "limit": {"type": "integer", "minimum": 0},
+        "allowFiltering": {"type": "boolean"}
+      },
+      "additionalProperties": false
+    },
+    "templateVariables": {"type": "object", "additionalProperties": {"type": "string"}},
+    "dualFormat": {"type": "boolean"},
+    "bucket": {"type": "string"},
+    "bucketAggregation": {"type": "string", "enum": ["", "avg", "sum", "min", "max", "count"]},
+    "timezone": {"type": "string"},
+    "keyspace": {"type": "string"},
+    "table": {"type": "string"},
+    "template": {"type": "string"},
+    "templateParams": {"type": "object", "additionalProperties": {"type": "string"}},
+    "emptyResult": {"type": "string", "enum": ["", "frame", "none", "notice"]},
+    "decimalFormat": {"type": "string", "enum": ["", "float", "string", "both"]},
+    "blobFormat": {"type": "string", "enum": ["", "hex", "base64", "text", "length"]},
+    "timeuuidFormat": {"type": "string", "enum": ["", "uuid", "time", "both"]},
+    "jsonFields": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "column": {"type": "string"},
+          "path": {"type": "string"},
+          "name": {"type": "string"}
+        },
+        "required": ["column", "path"],
+        "additionalProperties": false
+      }
+    },
+    "pageSize": {"type": "integer", "minimum": 0, "maximum": 100000},
+    "column": {"type": "string"},
+    "filter": {"type": "string"},
+    "limit": {"type": "integer", "minimum": 0, "maximum": 10000},
+    "rawPoints": {"type": "boolean"},
+    "maxRows": {"type": "integer", "minimum": 0},
+    "noCache": {"type": "boolean", "description": "Bypass the result cache"},
+    "keepOrder": {"type": "boolean", "description": "Keep the rows of descending clustering order tables as read"},
+    "ranges": {"type": "integer", "minimum": 0, "maximum": 65536, "description": "Token ranges the ring is split into by the count query type"},
+    "sampleRanges": {"type": "integer", "minimum": 0, "description": "Token ranges counted, the count of the others is extrapolated"},
+    "rangeTimeout": {"type": "string", "description": "Timeout of the count of a token range, e.g. 2s"},
+    "dashboardId": {"type": "integer", "description": "Set by the frontend, the dashboard shares of the query rate are keyed by it"},
+    "panelId": {"type": "integer"},
+    "sessionId": {"type": "string", "description": "The system_traces session read by the trace query type"},
+    "tracing": {"type": "boolean", "description": "Run the query with tracing, the traces are in the frame metadata"},
+    "app": {"type": "string", "description": "Set by the frontend, Explore queries without a LIMIT are sampled"},
+    "fullResult": {"type": "boolean", "description": "Do not sample Explore queries"},
+    "partitionBy": {"type": "array", "items": {"type": "string"}, "description": "Split the rows into a frame per value of these columns"},
+    "collectionFormat": {"type": "string", "enum": ["", "json", "join"], "description": "How list and set columns are returned, json by default or join for comma separated elements"},
+    "explodeMaps": {"type": "boolean", "description": "Return a field per key of map columns, labeled with the key"},
+    "tuplesAsJSON": {"type": "boolean", "description": "Return tuple columns as JSON text instead of a field per element"},
+    "explodeVectors": {"type": "boolean", "description": "Return a field per element of vector columns instead of JSON arrays"},
+    "columnTypes": {"type": "object", "additionalProperties": {"type": "string", "enum": ["number", "time", "string", "boolean"]}},
+    "coerceNumbers": {"type": "boolean", "description": "Return every numeric field as float64 and time fields without nulls, for Grafana expressions"},
+    "labelColumns": {"type": "array", "items": {"type": "string"}, "description": "Pivot the result into wide time series labeled by these columns"},
+    "convertToWide": {"type": "boolean", "description": "Convert long results to wide time series"},
+    "fill": {"type": "string", "enum": ["", "previous", "null", "value"], "description": "How missing values of wide conversions are filled, zero by default"},
+    "fillValue": {"type": "number"},
+    "alias": {"type": "string", "description": "Series name template, {{column}} placeholders are replaced by labels or row values and {{__field}} by the value column"},
+    "gapFill": {"type": "string", "enum": ["", "null", "zero", "previous"], "description": "Insert points in the gaps of time series"},
+    "gapInterval": {"type": "string", "description": "The interval of the inserted points, by default the bucket or the panel interval"},
+    "customPayload": {"type": "boolean", "description": "Attach the custom payload of the responses to the frame metadata"},
+    "timeShift": {"type": "string", "description": "Also run the query shifted by this duration, e.g. -7d"},
+    "sortByTime": {"type": "boolean", "description": "Sort the rows by time, by default for time series"},
+    "timeColumn": {"type": "string", "description": "The time axis column, by default the only timestamp column of the result"},
+    "timeUnit": {"type": "string", "enum": ["", "s", "ms", "us", "ns"], "description": "The epoch unit of a numeric time column, ms by default"},
+    "fieldOrder": {"type": "string", "enum": ["", "keys", "query"], "description": "keys puts the partition and clustering keys first, query keeps the selected order"},
+    "logs": {
+      "type": "object",
+      "description": "Maps the result columns to the log lines of the logs format",
+      "properties": {
+        "timestamp": {"type": "string"},
+        "body": {"type": "string"},
+        "level": {"type": "string"},
+        "labels": {"type": "array", "items": {"type": "string"}}
+      },
+      "additionalProperties": false
+    }
+  }
+}`
+
+// jsonSchema is the subset of JSON Schema the query model schema uses.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+	Required             []string               `json:"required"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+}
+
+var parsedQuerySchema = mustParseSchema(queryModelSchema)
+
+func mustParseSchema(s string) *jsonSchema {
+	var schema jsonSchema
+	if err := json.Unmarshal([]byte(s), &schema); err != nil {
+		panic(err)
+	}
+	return &schema
+}
+
+// schemaError is a machine readable validation error, Path is a JSON
+// pointer to the invalid value.
+type schemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// schemaErrors lists all the problems found in a query.
+type schemaErrors []schemaError
+
+func (e schemaErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Path + ": " + err.Message
+	}
+	return "invalid query: " + strings.Join(msgs, "; ")
+}
+
+// validateQueryJSON validates a query against the query model schema.
+func validateQueryJSON(body []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return schemaErrors{{Path: "", Message: "invalid JSON: " + err.Error()}}
+	}
+	errs := parsedQuerySchema.validate("", v, nil)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func jsonType(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if t == float64(int64(t)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func (s *jsonSchema) validate(path string, v interface{}, errs schemaErrors) schemaErrors {
+	typ := jsonType(v)
+	if typ == "null" && path != "" {
+		// absent and null properties are the same for the backend, the query itself must be an object
+		return errs
+	}
+	if s.Type != "" && s.Type != typ && !(s.Type == "number" && typ == "integer") {
+		return append(errs, schemaError{Path: path, Message: fmt.Sprintf("expected %s, got %s", s.Type, typ)})
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return append(errs, schemaError{Path: path, Message: fmt.Sprintf("%v is not one of %v", v, s.Enum)})
+		}
+	}
+	if n, ok := v.(float64); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			errs = append(errs, schemaError{Path: path, Message: fmt.Sprintf("must be at least %v", *s.Minimum)})
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			errs = append(errs, schemaError{Path: path, Message: fmt.Sprintf("must be at most %v", *s.Maximum)})
+		}
+	}
+	switch t := v.(type) {
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range t {
+				errs = s.Items.validate(fmt.Sprintf("%s/%d", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := t[name]; !ok {
+				errs = append(errs, schemaError{Path: path + "/" + name, Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		additional := s.additional()
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				errs = p.validate(path+"/"+name, t[name], errs)
+			} else if additional != nil {
+				errs = additional.validate(path+"/"+name, t[name], errs)
+			} else if string(s.AdditionalProperties) == "false" {
+				errs = append(errs, schemaError{Path: path + "/" + name, Message: "unknown property"})
+			}
+		}
+	}
+	return errs
+}
+
+// additional returns the schema of the properties not listed, nil when any
+// value is allowed or when additional properties are not allowed.
+func (s *jsonSchema) additional() *jsonSchema {
+	if len(s.AdditionalProperties) == 0 || s.AdditionalProperties[0] != '{' {
+		return nil
+	}
+	var res jsonSchema
+	if json.Unmarshal(s.AdditionalProperties, &res) != nil {
+		return nil
+	}
+	return &res
+}
+
+// queryValidationResult is the response of a POST to /query-schema.
+type queryValidationResult struct {
+	Valid  bool          `json:"valid"`
+	Errors []schemaError `json:"errors,omitempty"`
+}
+
+// handleQuerySchema serves the query model JSON Schema, a POST validates the
+// query in the request body against it.
+func (td *SampleDatasource) handleQuerySchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errs, ok := validateQueryJSON(body).(schemaErrors); ok {
+			writeJSON(w, http.StatusOK, queryValidationResult{Errors: errs})
+			return
+		}
+		writeJSON(w, http.StatusOK, queryValidationResult{Valid: true})
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(queryModelSchema)); err != nil {
+		log.DefaultLogger.Warn("Failed writing resource response", "err", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateQueryJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// paths are the JSON pointers of the expected errors, none when the query is valid
+		paths []string
+	}{
+		{name: "minimal query", query: `{"refId": "A", "queryText": "SELECT * FROM ks.t"}`},
+		{name: "grafana properties are allowed", query: `{"refId": "A", "datasource": {"uid": "x"}, "hide": false, "intervalMs": 1000}`},
+		{name: "null properties are absent", query: `{"queryText": null, "builder": null}`},
+		{name: "not an object", query: `[]`, paths: []string{""}},
+		{name: "invalid JSON", query: `{"queryText": `, paths: []string{""}},
+		{name: "wrong type", query: `{"queryText": 1}`, paths: []string{"/queryText"}},
+		{name: "integer for a number", query: `{"fillValue": 1}`},
+		{name: "number for an integer", query: `{"limit": 1.5}`, paths: []string{"/limit"}},
+		{name: "enum value", query: `{"format": "time_series"}`},
+		{name: "empty enum value", query: `{"format": ""}`},
+		{name: "not in enum", query: `{"format": "graph"}`, paths: []string{"/format"}},
+		{name: "enum of additional properties", query: `{"columnTypes": {"a": "time", "b": "date"}}`, paths: []string{"/columnTypes/b"}},
+		{name: "minimum", query: `{"limit": 0}`},
+		{name: "below minimum", query: `{"limit": -1}`, paths: []string{"/limit"}},
+		{name: "maximum", query: `{"ranges": 65536}`},
+		{name: "above maximum", query: `{"pageSize": 100001}`, paths: []string{"/pageSize"}},
+		{name: "minimum of a nested property", query: `{"builder": {"limit": -1}}`, paths: []string{"/builder/limit"}},
+		{name: "known nested properties", query: `{"builder": {"keyspace": "ks", "table": "t", "columns": ["a"]}}`},
+		{name: "unknown nested property", query: `{"builder": {"keyspace": "ks", "tabel": "t"}}`, paths: []string{"/builder/tabel"}},
+		{name: "unknown property of an array item", query: `{"jsonFields": [{"column": "a", "path": "$.b", "as": "c"}]}`, paths: []string{"/jsonFields/0/as"}},
+		{name: "required property", query: `{"jsonFields": [{"column": "a"}]}`, paths: []string{"/jsonFields/0/path"}},
+		{name: "array item type", query: `{"partitionBy": ["a", 1]}`, paths: []string{"/partitionBy/1"}},
+		{name: "typed additional properties", query: `{"templateParams": {"host": 1}}`, paths: []string{"/templateParams/host"}},
+		{
+			name:  "every error is listed",
+			query: `{"format": "graph", "limit": -1, "builder": {"x": 1}}`,
+			paths: []string{"/builder/x", "/format", "/limit"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateQueryJSON([]byte(tt.query))
+			if tt.paths == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			errs, ok := err.(schemaErrors)
+			if !ok {
+				t.Fatalf("expected schema errors, got %v", err)
+			}
+			var paths []string
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("got errors %v, want errors at %q", errs, tt.paths)
+			}
+		})
+	}
+}
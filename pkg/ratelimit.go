@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// dashboardActiveWindow is how long a dashboard keeps its share of the rate
+// after its last query.
+const dashboardActiveWindow = time.Minute
+
+// maxRateLimitWait bounds the time a query waits for its dashboard share,
+// queries that would wait longer are rejected.
+const maxRateLimitWait = 10 * time.Second
+
+type dashboardBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// dashboardLimiter shares the query rate of an instance fairly between the
+// dashboards querying it: each dashboard active in the last minute refills a
+// token bucket at an equal share of the rate, so one runaway dashboard can
+// not starve the others.
+type dashboardLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*dashboardBucket
+}
+
+func newDashboardLimiter(rate float64, burst int) *dashboardLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &dashboardLimiter{rate: rate, burst: b, buckets: make(map[string]*dashboardBucket)}
+}
+
+// reserve takes a token from the bucket of a dashboard and returns how long
+// the query has to wait for it.
+func (l *dashboardLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		if k != key && now.Sub(b.last) > dashboardActiveWindow {
+			delete(l.buckets, k)
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &dashboardBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	share := l.rate / float64(len(l.buckets))
+	b.tokens += now.Sub(b.last).Seconds() * share
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / share * float64(time.Second))
+}
+
+// wait blocks until the dashboard may run a query.
+func (l *dashboardLimiter) wait(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	d := l.reserve(key, time.Now())
+	if d == 0 {
+		return nil
+	}
+	if d > maxRateLimitWait {
+		l.cancel(key)
+		return fmt.Errorf("too many queries from this dashboard, its share of the datasource query rate is used up for the next %s", d.Round(time.Second))
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel(key)
+		return ctx.Err()
+	}
+}
+
+// cancel gives back the token of a query that did not run.
+func (l *dashboardLimiter) cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens++
+	}
+}
+
+// dashboardStats are the limiter state shown in /debug/state.
+type dashboardStats struct {
+	Dashboard string  `json:"dashboard"`
+	Tokens    float64 `json:"tokens"`
+}
+
+func (l *dashboardLimiter) stats() []dashboardStats {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]dashboardStats, 0, len(l.buckets))
+	for k, b := range l.buckets {
+		res = append(res, dashboardStats{Dashboard: k, Tokens: b.tokens})
+	}
+	return res
+}
+
+// dashboardKey identifies the dashboard a query comes from, from the
+// dashboardId and panelId the frontend adds to the queries or the
+// X-Dashboard-Uid and X-Panel-Id request headers. Queries of a panel outside a
+// dashboard share the panel key, the others (Explore, alerting) share "".
+// A query whose model can not be read fails instead of sharing a key.
+func dashboardKey(q backend.DataQuery, headers map[string]string) (string, error) {
+	var ids struct {
+		DashboardID json.Number `json:"dashboardId"`
+		PanelID     json.Number `json:"panelId"`
+	}
+	if err := json.Unmarshal(q.JSON, &ids); err != nil {
+		return "", fmt.Errorf("invalid query: %v", err)
+	}
+	dashboard, panel := ids.DashboardID.String(), ids.PanelID.String()
+	if dashboard == "" || dashboard == "0" {
+		dashboard = headers["X-Dashboard-Uid"]
+	}
+	if panel == "" || panel == "0" {
+		panel = headers["X-Panel-Id"]
+	}
+	if dashboard != "" && dashboard != "0" {
+		return "dashboard:" + dashboard, nil
+	}
+	if panel != "" && panel != "0" {
+		return "panel:" + panel, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// redacted replaces the sensitive values written to the plugin log.
+const redacted = "[redacted]"
+
+// sensitiveKeys are the parts of the names of settings, headers and log
+// arguments whose values are never logged.
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "apikey", "api_key", "credential"}
+
+// isSensitiveKey reports whether the value of a key is never logged.
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// logSecrets are the decrypted secure settings of the instances, scrubbed
+// from every log message, with the number of instances holding each.
+var logSecrets = struct {
+	sync.RWMutex
+	values map[string]int
+}{values: make(map[string]int)}
+
+// minSecretLength is the length under which a secure setting is not
+// scrubbed, a one or two character password would mangle any log text.
+const minSecretLength = 4
+
+// registerSecrets adds the decrypted secure settings of an instance to the
+// scrubbed secrets. The user names (the secure settings ending in user) are
+// deliberately left out: they are often common words like scylla and are
+// not secret on their own. It returns the added secrets, to unregister when
+// the instance is disposed.
+func registerSecrets(secure map[string]string) []string {
+	logSecrets.Lock()
+	defer logSecrets.Unlock()
+	var added []string
+	for k, v := range secure {
+		if len(v) >= minSecretLength && !strings.HasSuffix(strings.ToLower(k), "user") {
+			logSecrets.values[v]++
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+// unregisterSecrets removes the secrets of an instance, the secrets other
+// instances hold stay scrubbed.
+func unregisterSecrets(secrets []string) {
+	logSecrets.Lock()
+	defer logSecrets.Unlock()
+	for _, v := range secrets {
+		if logSecrets.values[v]--; logSecrets.values[v] <= 0 {
+			delete(logSecrets.values, v)
+		}
+	}
+}
+
+// scrub replaces the registered secrets in a text, and reports whether it
+// held any. A secret is only replaced where it is not part of a longer word,
+// so a password like scylla leaves the scylla_metrics keyspace alone.
+func scrub(s string) (string, bool) {
+	logSecrets.RLock()
+	defer logSecrets.RUnlock()
+	found := false
+	for secret := range logSecrets.values {
+		var replaced bool
+		if s, replaced = replaceWord(s, secret); replaced {
+			found = true
+		}
+	}
+	return s, found
+}
+
+// replaceWord replaces the occurrences of secret in s that are not preceded
+// nor followed by a word character.
+func replaceWord(s string, secret string) (string, bool) {
+	var b strings.Builder
+	last, found := 0, false
+	for from := 0; from < len(s); {
+		i := strings.Index(s[from:], secret)
+		if i < 0 {
+			break
+		}
+		start, end := from+i, from+i+len(secret)
+		if (start > 0 && isWordByte(s[start-1]) && isWordByte(secret[0])) ||
+			(end < len(s) && isWordByte(s[end]) && isWordByte(secret[len(secret)-1])) {
+			from = start + 1
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redacted)
+		last, from, found = end, end, true
+	}
+	if !found {
+		return s, false
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+
+// redactJSON returns a JSON document with the values of its sensitive keys
+// redacted.
+func redactJSON(raw []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		s, _ := scrub(string(raw))
+		return s
+	}
+	b, _ := json.Marshal(redactJSONValue(doc))
+	s, _ := scrub(string(b))
+	return s
+}
+
+func redactJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if isSensitiveKey(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redactJSONValue(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = redactJSONValue(e)
+		}
+	}
+	return v
+}
+
+// redactHeaders returns the headers of a request with the values of the
+// authentication headers redacted.
+func redactHeaders(headers map[string]string) map[string]string {
+	res := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if isSensitiveKey(k) {
+			v = redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// settingsSummary is the loggable form of datasource settings: the secure
+// settings are listed by name only.
+func settingsSummary(s *backend.DataSourceInstanceSettings) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	secure := make([]string, 0, len(s.DecryptedSecureJSONData))
+	for k := range s.DecryptedSecureJSONData {
+		secure = append(secure, k)
+	}
+	sort.Strings(secure)
+	return map[string]interface{}{
+		"id":               s.ID,
+		"name":             s.Name,
+		"url":              s.URL,
+		"jsonData":         redactJSON(s.JSONData),
+		"secureJsonFields": secure,
+	}
+}
+
+// pluginContextSummary is the loggable form of the context of a request.
+func pluginContextSummary(c backend.PluginContext) map[string]interface{} {
+	return map[string]interface{}{
+		"orgId":      c.OrgID,
+		"user":       pluginUser(c.User),
+		"datasource": settingsSummary(c.DataSourceInstanceSettings),
+	}
+}
+
+// requestBrief is the loggable form of a query request without the queries
+// themselves: the refIds and the number of queries.
+func requestBrief(req *backend.QueryDataRequest) []interface{} {
+	refIDs := make([]string, len(req.Queries))
+	for i, q := range req.Queries {
+		refIDs[i] = q.RefID
+	}
+	return []interface{}{"orgId", req.PluginContext.OrgID, "queries", len(req.Queries), "refIds", refIDs}
+}
+
+// requestSummary is the loggable form of a query request.
+func requestSummary(req *backend.QueryDataRequest) map[string]interface{} {
+	queries := make([]map[string]interface{}, len(req.Queries))
+	for i, q := range req.Queries {
+		queries[i] = map[string]interface{}{"refId": q.RefID, "timeRange": q.TimeRange, "query": redactJSON(q.JSON)}
+	}
+	return map[string]interface{}{
+		"context": pluginContextSummary(req.PluginContext),
+		"headers": redactHeaders(req.Headers),
+		"queries": queries,
+	}
+}
+
+// redactValue returns the loggable form of a log argument.
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case *backend.QueryDataRequest:
+		if t != nil {
+			return requestSummary(t)
+		}
+	case backend.QueryDataRequest:
+		return requestSummary(&t)
+	case backend.PluginContext:
+		return pluginContextSummary(t)
+	case *backend.DataSourceInstanceSettings:
+		return settingsSummary(t)
+	case backend.DataSourceInstanceSettings:
+		return settingsSummary(&t)
+	case json.RawMessage:
+		return redactJSON(t)
+	case string:
+		s, _ := scrub(t)
+		return s
+	case error:
+		if s, found := scrub(t.Error()); found {
+			return s
+		}
+		return t
+	case nil, bool, int, int64, float64:
+		return t
+	}
+	if s, found := scrub(fmt.Sprintf("%+v", v)); found {
+		return s
+	}
+	return v
+}
+
+// redactArgs returns the loggable form of the key and value arguments of
+// a log call: the values of sensitive keys are redacted.
+func redactArgs(args []interface{}) []interface{} {
+	res := make([]interface{}, len(args))
+	for i, a := range args {
+		if i%2 == 1 {
+			if key, ok := args[i-1].(string); ok && isSensitiveKey(key) {
+				res[i] = redacted
+				continue
+			}
+		}
+		res[i] = redactValue(a)
+	}
+	return res
+}
+
+// redactingLogger is the plugin logger, which never writes the secure
+// settings, the authentication headers or the registered secrets, whatever
+// the level. Debug messages are dropped before their arguments are
+// formatted unless debug logging is enabled.
+type redactingLogger struct {
+	logger log.Logger
+	debug  bool
+}
+
+// debugLogging reports whether debug messages are logged, set by log_level
+// in the [plugin.scylladb-scylla-datasource] section of the Grafana
+// configuration, which Grafana passes as GF_PLUGIN_LOG_LEVEL.
+func debugLogging() bool {
+	return strings.EqualFold(os.Getenv("GF_PLUGIN_LOG_LEVEL"), "debug")
+}
+
+func (l redactingLogger) Debug(msg string, args ...interface{}) {
+	if !l.debug {
+		return
+	}
+	msg, _ = scrub(msg)
+	l.logger.Debug(msg, redactArgs(args)...)
+}
+
+func (l redactingLogger) Info(msg string, args ...interface{}) {
+	msg, _ = scrub(msg)
+	l.logger.Info(msg, redactArgs(args)...)
+}
+
+func (l redactingLogger) Warn(msg string, args ...interface{}) {
+	msg, _ = scrub(msg)
+	l.logger.Warn(msg, redactArgs(args)...)
+}
+
+func (l redactingLogger) Error(msg string, args ...interface{}) {
+	msg, _ = scrub(msg)
+	l.logger.Error(msg, redactArgs(args)...)
+}
+
+func init() {
+	log.DefaultLogger = redactingLogger{logger: log.DefaultLogger, debug: debugLogging()}
+}
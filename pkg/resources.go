@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// newResourceHandler returns the handler for the datasource resource calls
+// (/api/datasources/:id/resources/*).
+func newResourceHandler(ds *SampleDatasource) backend.CallResourceHandler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/state", ds.handleDebugState)
+	mux.HandleFunc("/keyspaces", ds.handleKeyspaces)
+	mux.HandleFunc("/keyspaces/", ds.handleKeyspaces)
+	mux.HandleFunc("/tables/", ds.handleTables)
+	mux.HandleFunc("/count-estimate", ds.handleCountEstimate)
+	mux.HandleFunc("/virtual-tables", ds.handleVirtualTables)
+	mux.HandleFunc("/validate", ds.handleValidateQuery)
+	mux.HandleFunc("/query-schema", ds.handleQuerySchema)
+	mux.HandleFunc("/validate-settings", ds.handleValidateSettings)
+	mux.HandleFunc("/export", ds.handleExport)
+	mux.HandleFunc("/query-json", ds.handleQueryJSON)
+	mux.HandleFunc("/tag-keys", ds.handleTagKeys)
+	mux.HandleFunc("/tag-values", ds.handleTagValues)
+	mux.HandleFunc("/annotations", ds.handleAnnotations)
+	mux.HandleFunc("/functions", ds.handleFunctions)
+	mux.HandleFunc("/cancel", ds.handleCancel)
+	return httpadapter.New(trackResourceCalls(mux))
+}
+
+// resourceCallKey is the context key of the resourceCall of a request.
+type resourceCallKey struct{}
+
+// resourceCall is a resource call in flight, registered on the instance
+// serving it by getInstance.
+type resourceCall struct {
+	done func()
+}
+
+// trackResourceCalls keeps every resource call registered on its instance
+// until the handler returns, so an idle instance is not reclaimed under it.
+func trackResourceCalls(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := &resourceCall{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resourceCallKey{}, call)))
+		if call.done != nil {
+			call.done()
+		}
+	})
+}
+
+// getInstance returns the datasource instance of a resource call.
+func (td *SampleDatasource) getInstance(r *http.Request) (*instanceSettings, error) {
+	instance, err := td.im.Get(httpadapter.PluginConfigFromContext(r.Context()))
+	if err != nil {
+		return nil, err
+	}
+	instSetting, ok := instance.(*instanceSettings)
+	if !ok {
+		return nil, errors.New("unexpected datasource instance type")
+	}
+	instSetting.touch()
+	if call, ok := r.Context().Value(resourceCallKey{}).(*resourceCall); ok && call.done == nil {
+		call.done = instSetting.running.startCall()
+	}
+	return instSetting, nil
+}
+
+// isAdmin reports whether the user who made a resource call is an organization admin.
+func isAdmin(r *http.Request) bool {
+	user := httpadapter.UserFromContext(r.Context())
+	return user != nil && user.Role == "Admin"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.DefaultLogger.Warn("Failed marsheling resource response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.DefaultLogger.Warn("Failed writing resource response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// defaultResultCacheSize is the number of results kept when resultCacheSize is not set.
+const defaultResultCacheSize = 100
+
+type resultEntry struct {
+	key     string
+	frames  []*data.Frame
+	expires time.Time
+	bytes   int64
+}
+
+// resultCache is a bounded, least recently used, cache of query results so
+// identical queries of several panels or frequent refreshes do not all hit
+// Scylla. Only successful results are cached.
+type resultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	hits    uint64
+	misses  uint64
+	// bytes is the estimated memory held by the cached frames
+	bytes int64
+}
+
+func newResultCache(ttl time.Duration, size int) *resultCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = defaultResultCacheSize
+	}
+	return &resultCache{ttl: ttl, size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// resultCacheKey identifies a query by its model, time range and resolution.
+// The refId and the dashboard and panel ids, which only key the rate limiter,
+// are left out so identical queries of different panels share a result. The
+// app is only kept for Explore, whose queries are sampled.
+func resultCacheKey(q backend.DataQuery) string {
+	var model map[string]interface{}
+	if err := json.Unmarshal(q.JSON, &model); err != nil {
+		return ""
+	}
+	delete(model, "refId")
+	delete(model, "dashboardId")
+	delete(model, "panelId")
+	if model["app"] != exploreApp {
+		delete(model, "app")
+	}
+	body, _ := json.Marshal(model)
+	h := sha256.New()
+	h.Write(body)
+	fmt.Fprintf(h, "\x00%d\x00%d\x00%d\x00%d", q.TimeRange.From.UnixNano(), q.TimeRange.To.UnixNano(), q.MaxDataPoints, q.Interval)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *resultCache) get(key string) ([]*data.Frame, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if ok && time.Now().Before(el.Value.(*resultEntry).expires) {
+		c.hits++
+		c.order.MoveToFront(el)
+		return el.Value.(*resultEntry).frames, true
+	}
+	if ok {
+		c.remove(el)
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *resultCache) put(key string, frames []*data.Frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	entry := &resultEntry{key: key, frames: frames, expires: time.Now().Add(c.ttl), bytes: framesBytes(frames)}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += entry.bytes
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *resultCache) remove(el *list.Element) {
+	entry := el.Value.(*resultEntry)
+	c.order.Remove(el)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.bytes
+}
+
+// shrink drops the least recently used results until the cache holds at
+// most bytes.
+func (c *resultCache) shrink(bytes int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.bytes > bytes && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// resultCacheStats are the cache counters shown in /debug/state.
+type resultCacheStats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func (c *resultCache) stats() *resultCacheStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &resultCacheStats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses, Bytes: c.bytes}
+}
+
+// copyFrames returns shallow copies of frames, the fields are shared. The SDK
+// sets the refId of the frames it sends, so cached frames are never sent
+// themselves. Copies returned from the cache get a "Cached" stat.
+func copyFrames(frames []*data.Frame, refID string, hit bool) []*data.Frame {
+	res := make([]*data.Frame, len(frames))
+	for i, f := range frames {
+		frame := *f
+		frame.RefID = refID
+		meta := data.FrameMeta{}
+		if f.Meta != nil {
+			meta = *f.Meta
+		}
+		if hit {
+			meta.Stats = append(append([]data.QueryStat(nil), meta.Stats...), data.QueryStat{
+				FieldConfig: data.FieldConfig{DisplayName: "Cached"},
+				Value:       1,
+			})
+		}
+		frame.Meta = &meta
+		res[i] = &frame
+	}
+	return res
+}
+
+// cachedQuery runs a query through the result cache of the instance, unless
+// the query sets noCache, is traced or streams its rows to a page sink.
+func (td *SampleDatasource) cachedQuery(ctx context.Context, instance *instanceSettings, q backend.DataQuery) backend.DataResponse {
+	var opts struct {
+		NoCache bool `json:"noCache"`
+		Tracing bool `json:"tracing"`
+	}
+	if instance.results == nil || json.Unmarshal(q.JSON, &opts) != nil || opts.NoCache || opts.Tracing || pageSinkFromContext(ctx) != nil {
+		return td.safeQuery(ctx, instance, q)
+	}
+	key := resultCacheKey(q)
+	if key == "" {
+		return td.safeQuery(ctx, instance, q)
+	}
+	if frames, ok := instance.results.get(key); ok {
+		return backend.DataResponse{Frames: copyFrames(frames, q.RefID, true)}
+	}
+	res := td.safeQuery(ctx, instance, q)
+	if res.Error == nil {
+		instance.results.put(key, copyFrames(res.Frames, "", false))
+	}
+	return res
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// rewriteRule is a regular expression replacement applied to every query,
+// e.g. to redirect a renamed keyspace during a schema migration.
+type rewriteRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type compiledRewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// compileRewriteRules compiles the configured rewrite rules, in order.
+func compileRewriteRules(rules []rewriteRule) ([]compiledRewriteRule, error) {
+	res := make([]compiledRewriteRule, 0, len(rules))
+	for i, r := range rules {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("rewrite rule %d has an empty pattern", i+1)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite rule %d has an invalid pattern: %v", i+1, err)
+		}
+		res = append(res, compiledRewriteRule{re: re, replacement: r.Replacement})
+	}
+	return res, nil
+}
+
+// rewriteQuery applies the rewrite rules to a query, each rule is applied to
+// the result of the previous one. Replacements may use $1 style group references.
+func rewriteQuery(query string, rules []compiledRewriteRule) string {
+	for _, r := range rules {
+		query = r.re.ReplaceAllString(query, r.replacement)
+	}
+	return query
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// rowScratch holds the per row buffers of the row scan loop. The values are
+// copied into the frame fields, so the buffers are reused for every row and,
+// through rowScratchPool, across queries.
+type rowScratch struct {
+	dests []interface{}
+	// columns holds the dests of each column, the elements of a tuple
+	// are scanned into a dest each
+	columns [][]interface{}
+	tuples  []bool
+	vals    []interface{}
+}
+
+var rowScratchPool = sync.Pool{
+	New: func() interface{} {
+		return &rowScratch{}
+	},
+}
+
+// getRowScratch returns scratch buffers for rows of the columns and
+// numCols values, extra values (e.g. _host) follow the columns.
+func getRowScratch(cols []gocql.ColumnInfo, numCols int) *rowScratch {
+	s := rowScratchPool.Get().(*rowScratch)
+	if cap(s.vals) < numCols {
+		s.vals = make([]interface{}, numCols)
+	}
+	s.vals = s.vals[:numCols]
+	s.dests, s.columns, s.tuples = s.dests[:0], s.columns[:0], s.tuples[:0]
+	for _, c := range cols {
+		start := len(s.dests)
+		tuple, ok := c.TypeInfo.(gocql.TupleTypeInfo)
+		if ok {
+			for _, elem := range tuple.Elems {
+				s.dests = append(s.dests, scanDest(elem))
+			}
+		} else {
+			s.dests = append(s.dests, scanDest(c.TypeInfo))
+		}
+		s.columns = append(s.columns, s.dests[start:len(s.dests):len(s.dests)])
+		s.tuples = append(s.tuples, ok)
+	}
+	return s
+}
+
+// scanDest returns a scan destination of a column, a pointer to a pointer
+// to the column type, which the driver sets to nil for NULL instead of the
+// zero value. Custom types, which the driver has no type of, are scanned as
+// their bytes.
+func scanDest(info gocql.TypeInfo) interface{} {
+	if info.Type() == gocql.TypeCustom {
+		return new(*customValue)
+	}
+	return reflect.New(reflect.TypeOf(info.New())).Interface()
+}
+
+// scannedValue returns the value scanned into a scanDest, nil for NULL.
+func scannedValue(dest interface{}) interface{} {
+	v := reflect.ValueOf(dest).Elem()
+	if v.IsNil() {
+		return nil
+	}
+	return v.Elem().Interface()
+}
+
+// value returns the scanned value of column i, nil for NULL. A tuple is the
+// list of its element values.
+func (s *rowScratch) value(i int) interface{} {
+	if !s.tuples[i] {
+		return scannedValue(s.columns[i][0])
+	}
+	elems := make([]interface{}, len(s.columns[i]))
+	null := true
+	for j, dest := range s.columns[i] {
+		elems[j] = scannedValue(dest)
+		null = null && elems[j] == nil
+	}
+	if null {
+		return nil
+	}
+	return elems
+}
+
+func putRowScratch(s *rowScratch) {
+	for i := range s.vals {
+		s.vals[i] = nil
+	}
+	for i := range s.dests {
+		s.dests[i] = nil
+	}
+	for i := range s.columns {
+		s.columns[i] = nil
+	}
+	rowScratchPool.Put(s)
+}
+
+// growFrame extends the frame fields by the rows of the page being read, at
+// most limit rows when limit is set, so the fields are allocated once per
+// page instead of growing row by row.
+func growFrame(frame *data.Frame, pageRows int, filled int, limit int) {
+	grow := pageRows
+	if limit > 0 && filled+grow > limit {
+		grow = limit - filled
+	}
+	if grow < 1 {
+		grow = 1
+	}
+	frame.Extend(grow)
+}
+
+// trimFrame drops the preallocated rows that were not filled.
+func trimFrame(frame *data.Frame, filled int) *data.Frame {
+	if frame.Rows() == filled {
+		return frame
+	}
+	rows := make([]int, filled)
+	for i := range rows {
+		rows[i] = i
+	}
+	return reorderRows(frame, rows)
+}
@@ -1,11 +1,13 @@
 package main
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"time"
 	"gopkg.in/inf.v0"
 	"strconv"
 	"math/big"
+	"net"
 	"errors"
 
 	"fmt"
@@ -16,6 +18,7 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"strings"
+	"sync"
 )
 
 // newDatasource returns datasource.ServeOpts.
@@ -30,8 +33,9 @@ func newDatasource() datasource.ServeOpts {
 	}
 
 	return datasource.ServeOpts{
-		QueryDataHandler:   ds,
-		CheckHealthHandler: ds,
+		QueryDataHandler:    ds,
+		CheckHealthHandler:  ds,
+		CallResourceHandler: newResourceHandler(ds),
 	}
 }
 
@@ -54,7 +58,8 @@ func (td *SampleDatasource) QueryData(ctx context.Context, req *backend.QueryDat
             log.DefaultLogger.Info("Recovered in QueryData", "error", r)
         }
     }()
-	log.DefaultLogger.Info("QueryData", "request", req)
+	log.DefaultLogger.Info("QueryData", requestBrief(req)...)
+	log.DefaultLogger.Debug("QueryData", "request", req)
 
 	instance, err := td.im.Get(req.PluginContext)
 	if err != nil {
@@ -68,42 +73,211 @@ func (td *SampleDatasource) QueryData(ctx context.Context, req *backend.QueryDat
         log.DefaultLogger.Info("Failed getting connection")
         return nil, nil
     }
-	// loop over queries and execute them individually.
+	instSetting.touch()
+	// execute the queries concurrently, at most maxConcurrentQueries at a time.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, instSetting.maxConcurrentQueries())
+	queued := time.Now()
 	for _, q := range req.Queries {
-		res := td.query(ctx, instSetting, q)
+		wg.Add(1)
+		go func(q backend.DataQuery) {
+			defer wg.Done()
+			res := td.runQuery(ctx, instSetting, pluginUser(req.PluginContext.User), req.Headers, q, slots, queued)
 
-		// save the response in a hashmap
-		// based on with RefID as identifier
-		response.Responses[q.RefID] = res
+			// save the response in a hashmap
+			// based on with RefID as identifier
+			mu.Lock()
+			response.Responses[q.RefID] = res
+			mu.Unlock()
+		}(q)
 	}
+	wg.Wait()
 
 	return response, nil
 }
 
+// runQuery runs a query of a request once the rate limit of its dashboard
+// lets it, in one of the execution slots of the request, registered in the
+// running queries for /cancel.
+func (td *SampleDatasource) runQuery(ctx context.Context, instance *instanceSettings, user string, headers map[string]string, q backend.DataQuery, slots chan struct{}, queued time.Time) backend.DataResponse {
+	key, err := dashboardKey(q, headers)
+	if err == nil {
+		// wait for the dashboard share before taking a slot, so
+		// rate limited queries do not hold up the others
+		err = instance.limiter.wait(ctx, key)
+	}
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+	slots <- struct{}{}
+	defer func() { <-slots }()
+	qctx, done := instance.running.start(ctx, user, q, key)
+	res := td.cachedQuery(withQueueWait(qctx, time.Since(queued)), instance, q)
+	if done() {
+		return backend.DataResponse{Error: errQueryCancelled}
+	}
+	return res
+}
+
+// safeQuery runs a query, a panic fails the query instead of the plugin process.
+func (td *SampleDatasource) safeQuery(ctx context.Context, instance *instanceSettings, q backend.DataQuery) (res backend.DataResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Info("Recovered in query", "refId", q.RefID, "error", r)
+			res = backend.DataResponse{Error: fmt.Errorf("query failed: %v", r)}
+		}
+	}()
+	res = td.query(ctx, instance, q)
+	if pageSinkFromContext(ctx) != nil {
+		// the rows were streamed, the options on the whole result do not apply
+		return res
+	}
+	var opts struct {
+		Alias         string `json:"alias"`
+		TimeShift     string `json:"timeShift"`
+		CoerceNumbers bool   `json:"coerceNumbers"`
+	}
+	json.Unmarshal(q.JSON, &opts)
+	if res.Error == nil && opts.TimeShift != "" {
+		res.Error = td.timeShiftQuery(ctx, instance, q, opts.TimeShift, &res)
+	}
+	if res.Error == nil {
+		res.Error = gapFill(res.Frames, q)
+	}
+	if res.Error == nil && opts.CoerceNumbers {
+		coerceFrames(res.Frames)
+	}
+	applyAlias(res.Frames, opts.Alias)
+	instance.addMonitoringLinks(res.Frames)
+	return res
+}
+
 type queryModel struct {
 	Format string `json:"format"`
 	QueryTxt string `json:"queryTxt"`
+	QueryType string `json:"queryType"`
+	EditorMode string `json:"editorMode"`
+	Builder *builderQuery `json:"builder"`
+	// TemplateVariables are the dashboard variables the frontend replaced in the query
+	TemplateVariables map[string]string `json:"templateVariables"`
+	// DualFormat returns the time series frames along with the table frame
+	DualFormat bool `json:"dualFormat"`
+	// Bucket downsamples the result into calendar (day, week, month, year) or fixed duration buckets
+	Bucket string `json:"bucket"`
+	BucketAggregation string `json:"bucketAggregation"`
+	Timezone string `json:"timezone"`
+	// Keyspace and Table select the schema listed by the tables and columns variable queries
+	Keyspace string `json:"keyspace"`
+	Table string `json:"table"`
+	// Template is the name of a query template of the datasource, run with TemplateParams
+	Template string `json:"template"`
+	TemplateParams map[string]string `json:"templateParams"`
+	// EmptyResult overrides the emptyResult datasource setting
+	EmptyResult string `json:"emptyResult"`
+	// JSONFields extracts values of text columns holding JSON into their own fields
+	JSONFields []jsonField `json:"jsonFields"`
+	// PageSize overrides the pageSize datasource setting
+	PageSize int `json:"pageSize"`
+	// Column, Filter and Limit select the values listed by the distinct query type
+	Column string `json:"column"`
+	Filter string `json:"filter"`
+	Limit int `json:"limit"`
+	// RawPoints keeps every row, results larger than MaxDataPoints are otherwise downsampled
+	RawPoints bool `json:"rawPoints"`
+	// MaxRows stops reading the result after this many rows, it can not raise the maxRows datasource setting
+	MaxRows int `json:"maxRows"`
+	// KeepOrder keeps the rows of descending clustering order tables as they are read
+	KeepOrder bool `json:"keepOrder"`
+	// Ranges, SampleRanges and RangeTimeout tune the token ranges counted by the count query type
+	Ranges int `json:"ranges"`
+	SampleRanges int `json:"sampleRanges"`
+	RangeTimeout string `json:"rangeTimeout"`
+	// Logs maps the result columns to the log lines of the logs format
+	Logs logsMapping `json:"logs"`
+	// SessionID is the query trace session read by the trace query type
+	SessionID string `json:"sessionId"`
+	// Tracing runs the query with tracing and attaches the traces to the frame metadata
+	Tracing bool `json:"tracing"`
+	// FieldOrder is keys (default) to put the key columns first, or query to keep the selected order
+	FieldOrder string `json:"fieldOrder"`
+	// App is the Grafana app the query is run from, Explore queries are sampled unless FullResult is set
+	App string `json:"app"`
+	FullResult bool `json:"fullResult"`
+	// LabelColumns pivots the result into wide time series with these columns as labels
+	LabelColumns []string `json:"labelColumns"`
+	// ConvertToWide converts long results to wide time series, missing values are filled as set by Fill and FillValue
+	ConvertToWide bool `json:"convertToWide"`
+	Fill string `json:"fill"`
+	FillValue float64 `json:"fillValue"`
+	// Alias names the series, {{column}} placeholders are resolved per series
+	Alias string `json:"alias"`
+	// TimeColumn is the time axis, by default the only timestamp column, TimeUnit the epoch unit of a numeric one
+	TimeColumn string `json:"timeColumn"`
+	TimeUnit string `json:"timeUnit"`
+	// GapFill inserts null, zero or previous points every GapInterval in the gaps of time series
+	GapFill string `json:"gapFill"`
+	GapInterval string `json:"gapInterval"`
+	// SortByTime sorts the rows by the time field, by default only for time series
+	SortByTime *bool `json:"sortByTime"`
+	// TimeShift also runs the query shifted by this duration (e.g. -7d), as frames labeled timeShift
+	TimeShift string `json:"timeShift"`
+	// CustomPayload attaches the custom payload of the responses, e.g. of Scylla extensions, to the frame metadata
+	CustomPayload bool `json:"customPayload"`
+	// PartitionBy splits the rows into a frame per value of these columns, labeled with the values
+	PartitionBy []string `json:"partitionBy"`
+	// CollectionFormat is how list and set columns are returned: json (the default) or join, their comma separated elements
+	CollectionFormat string `json:"collectionFormat"`
+	// ExplodeMaps returns a field per key of map columns, labeled with the key
+	ExplodeMaps bool `json:"explodeMaps"`
+	// TuplesAsJSON returns tuple columns as JSON text instead of a field per element
+	TuplesAsJSON bool `json:"tuplesAsJSON"`
+	// ExplodeVectors returns a field per element of vector columns instead of JSON arrays
+	ExplodeVectors bool `json:"explodeVectors"`
+	// ColumnTypes forces the field type of result columns: number, time, string or boolean
+	ColumnTypes map[string]string `json:"columnTypes"`
+	// CoerceNumbers returns every numeric field as float64 and time fields without nulls, for Grafana expressions
+	CoerceNumbers bool `json:"coerceNumbers"`
+	// DecimalFormat overrides the decimalFormat datasource setting: float, string (the exact text) or both
+	DecimalFormat string `json:"decimalFormat"`
+	// BlobFormat is how blob columns are returned: hex, base64, text (UTF-8 when valid, else hex) or length, by default the text Blob
+	BlobFormat string `json:"blobFormat"`
+	// TimeUUIDFormat is how timeuuid columns are returned: uuid (the default), time, their embedded time, or both, the time and a column_uuid field
+	TimeUUIDFormat string `json:"timeuuidFormat"`
+}
+
+// sortRowsByTime reports whether the rows are sorted by time, by default
+// when the result is converted to time series.
+func (qm *queryModel) sortRowsByTime() bool {
+	if qm.SortByTime != nil {
+		return *qm.SortByTime
+	}
+	return qm.Format == "time_series" || qm.ConvertToWide || len(qm.LabelColumns) > 0
+}
+
+// isBuilder reports whether the query was created with the query builder.
+func (qm *queryModel) isBuilder() bool {
+	return qm.EditorMode == builderMode && qm.Builder != nil
 }
 
 func getTypeArray(typ string) interface{} {
-    log.DefaultLogger.Debug("getTypeArray", "type", typ)
     switch t := typ; t {
-        case "timestamp":
-            return []time.Time{}
-        case "bigint", "int":
-            return []int64{}
+        case "timestamp", "date":
+            return []*time.Time{}
+        case "bigint", "int", "counter", "time", "duration":
+            return []*int64{}
         case "smallint":
-            return []int16{}
+            return []*int16{}
         case "boolean":
-            return []bool{}
+            return []*bool{}
         case "double", "varint", "decimal":
-            return []float64{}
+            return []*float64{}
         case "float":
-            return []float32{}
+            return []*float32{}
         case "tinyint":
-            return []int8{}
+            return []*int8{}
         default:
-            return []string{}
+            return []*string{}
     }
 }
 
@@ -120,6 +294,14 @@ func toValue(val interface{}, typ string) interface{} {
             return t
         case gocql.UUID:
             return t.String()
+        case time.Duration:
+            // time, the nanoseconds since midnight
+            return int64(t)
+        case gocql.Duration:
+            return durationNanoseconds(t)
+        case net.IP:
+            // inet, in dotted or colon notation
+            return t.String()
         case int:
             return int64(t)
         case *inf.Dec:
@@ -147,25 +329,180 @@ func (td *SampleDatasource) query(ctx context.Context, instance *instanceSetting
 
 	response := backend.DataResponse{}
 
+	if err := validateQueryJSON(query.JSON); err != nil {
+		log.DefaultLogger.Info("Invalid query", "err", err)
+		response.Error = err
+		return response
+	}
 	response.Error = json.Unmarshal(query.JSON, &hosts)
 	var v interface{}
 	json.Unmarshal(query.JSON, &v)
-	dt := v.(map[string]interface{})
 	if response.Error != nil {
 	   log.DefaultLogger.Warn("Failed unmarsheling json", "err", response.Error, "json ", string(query.JSON))
 		return response
 	}
+	dt, ok := v.(map[string]interface{})
+	if !ok {
+		response.Error = fmt.Errorf("the query must be a JSON object, got %s", string(query.JSON))
+		return response
+	}
 
-	// Log a warning if `Format` is empty.
+	// Log when `Format` is empty.
 	if hosts.Format == "" {
-		log.DefaultLogger.Info("format is empty. defaulting to time series")
+		log.DefaultLogger.Debug("format is empty, returning the frame as is")
+	}
+
+	if isVariableQueryType(hosts.QueryType) && hosts.QueryType != "query" {
+	   values, err := instance.schemaVariableValues(hosts)
+	   if err != nil {
+	       log.DefaultLogger.Info("Failed reading variable values", "err", err)
+	       response.Error = withHint(err)
+	       return response
+	   }
+	   response.Frames = append(response.Frames, variableFrame(values))
+	   return response
+	}
+
+	if hosts.QueryType == countQueryType {
+	   return instance.countResponse(ctx, hosts)
+	}
+	if hosts.QueryType == traceQueryType {
+	   return instance.traceResponse(ctx, hosts)
 	}
 
 	// create data frame response
 	frame := data.NewFrame("response")
+	querytxt, hasQuery := "", false
 	if val, ok := dt["queryText"]; ok {
-	   querytxt := fmt.Sprintf("%v", val)
-	   log.DefaultLogger.Debug("queryText found", "querytxt", querytxt, "instance", instance)
+	   querytxt = fmt.Sprintf("%v", val)
+	   hasQuery = true
+	}
+	var args []interface{}
+	var distinctColumn string
+	converters := map[string]columnConverter{}
+	if hosts.isBuilder() {
+	   var err error
+	   querytxt, args, err = hosts.Builder.build(query.TimeRange, instance)
+	   if err != nil {
+	       log.DefaultLogger.Info("Failed building query", "err", err)
+	       response.Error = err
+	       return response
+	   }
+	   converters = hosts.Builder.converters()
+	   hasQuery = true
+	} else if hosts.Template != "" {
+	   var err error
+	   if querytxt, args, err = instance.templateQuery(hosts.Template, hosts.TemplateParams); err != nil {
+	       log.DefaultLogger.Info("Failed expanding query template", "err", err)
+	       response.Error = err
+	       return response
+	   }
+	   hasQuery = true
+	} else if hosts.QueryType == cdcQueryType {
+	   var err error
+	   if querytxt, args, err = instance.cdcQuery(hosts, query.TimeRange); err != nil {
+	       log.DefaultLogger.Info("Failed building cdc query", "err", err)
+	       response.Error = withHint(err)
+	       return response
+	   }
+	   converters = cdcConverters()
+	   hasQuery = true
+	} else if hosts.QueryType == distinctQueryType {
+	   var err error
+	   if querytxt, distinctColumn, err = instance.distinctQuery(hosts); err != nil {
+	       log.DefaultLogger.Info("Failed building distinct query", "err", err)
+	       response.Error = withHint(err)
+	       return response
+	   }
+	   hasQuery = true
+	} else if isVirtualQueryType(hosts.QueryType) {
+	   var err error
+	   if querytxt, err = instance.virtualQuery(hosts.QueryType); err != nil {
+	       log.DefaultLogger.Info("Virtual table not available", "err", err)
+	       response.Error = err
+	       return response
+	   }
+	   hasQuery = true
+	}
+	var bucket bucketFunc
+	if hosts.Bucket != "" {
+	   var err error
+	   if bucket, err = parseBucket(hosts.Bucket, hosts.Timezone); err != nil {
+	       response.Error = err
+	       return response
+	   }
+	}
+	if hosts.MaxRows < 0 {
+	   response.Error = fmt.Errorf("invalid maxRows %d", hosts.MaxRows)
+	   return response
+	}
+	if hosts.PageSize < 0 || hosts.PageSize > maxPageSize {
+	   response.Error = fmt.Errorf("invalid pageSize %d, use 1 to %d rows", hosts.PageSize, maxPageSize)
+	   return response
+	}
+	if err := checkCollectionFormat(hosts.CollectionFormat); err != nil {
+	   response.Error = err
+	   return response
+	}
+	decimalFormat := hosts.DecimalFormat
+	if decimalFormat == "" {
+	   decimalFormat = instance.settings.DecimalFormat
+	}
+	if err := checkDecimalFormat(decimalFormat); err != nil {
+	   response.Error = err
+	   return response
+	}
+	if err := checkBlobFormat(hosts.BlobFormat); err != nil {
+	   response.Error = err
+	   return response
+	}
+	if err := checkTimeUUIDFormat(hosts.TimeUUIDFormat); err != nil {
+	   response.Error = err
+	   return response
+	}
+	if err := checkColumnTypes(hosts.ColumnTypes); err != nil {
+	   response.Error = err
+	   return response
+	}
+	if err := checkJSONFields(hosts.JSONFields); err != nil {
+	   response.Error = err
+	   return response
+	}
+	fill, err := parseFillMissing(hosts.Fill, hosts.FillValue)
+	if err != nil {
+	   response.Error = err
+	   return response
+	}
+	timings := &queryTimings{queueWait: queueWaitFromContext(ctx)}
+	sink := pageSinkFromContext(ctx)
+	interner := newStringInterner()
+	var macros map[string]string
+	var tracer *traceCollector
+	var timeColumn string
+	var payloads customPayloads
+	var subErrors subQueryErrors
+	var raw *rawColumns
+	if hosts.CustomPayload {
+	   payloads = customPayloads{}
+	}
+	if hosts.Tracing {
+	   tracer = &traceCollector{}
+	}
+	if hasQuery {
+	   querytxt, macros = expandMacros(querytxt, query)
+	   querytxt = rewriteQuery(querytxt, instance.rewrites)
+	   if err := instance.checkQuery(querytxt); err != nil {
+	       log.DefaultLogger.Info("Query rejected", "err", err)
+	       instance.errors.add(query.RefID, err)
+	       response.Error = err
+	       return response
+	   }
+	   sampled := 0
+	   if hosts.App == exploreApp && !hosts.FullResult {
+	       if limited, ok := sampleQuery(querytxt, instance.exploreLimit()); ok {
+	           querytxt, sampled = limited, instance.exploreLimit()
+	       }
+	   }
 	   queryHost, ok := dt["queryHost"];
 	   var addHost bool = false
 	   var hostList []string = []string{""}
@@ -178,23 +515,112 @@ func (td *SampleDatasource) query(ctx context.Context, instance *instanceSetting
            }
 	   }
 
-	   for hostIndx, specificHost := range hostList {
+	   var warnings []string
+	   maxRows := instance.maxRows(hosts.MaxRows)
+	   truncated := false
+	   filled := 0
+	   // flushed are the rows passed to the sink, which are no longer in the frame
+	   flushed := 0
+	   // the fields are made from the columns of the first host that answers
+	   columnsRead := false
+	   // the varint and decimal columns returned with a float field, by the both decimalFormat
+	   var decimalColumns []string
+	   // the rows are the JSON objects of a SELECT JSON query, expanded into a field per key
+	   selectJSON := false
+	   subErrors.total = len(hostList)
+	   if keyspaces := queryKeyspaces(querytxt); len(keyspaces) > 0 {
+	       subErrors.keyspace = keyspaces[0]
+	   }
+	   for _, specificHost := range hostList {
+           if truncated {
+               break
+           }
+           start := time.Now()
+           hostStart, hostFirstRow := start, filled
            session, err := instance.getSession(strings.TrimSpace(specificHost))
+           start = since(&timings.connect, start)
            if err != nil {
                log.DefaultLogger.Warn("Failed getting session", "err", err, "host", specificHost)
-               return response
+               instance.errors.add(query.RefID, err)
+               subErrors.add(strings.TrimSpace(specificHost), err)
+               continue
+           }
+           q := instance.newQuery(ctx, session, querytxt, args...)
+           if hosts.PageSize > 0 {
+               q = q.PageSize(hosts.PageSize)
+           }
+           if tracer != nil {
+               q = q.Trace(tracer)
            }
-           iter := session.Query(querytxt).Iter()
+           iter := q.Iter()
+           start = since(&timings.execute, start)
            cols := iter.Columns()
            var numCols int = len(cols)
            if addHost {
                numCols++
            }
-           if hostIndx == 0 {
+           if !columnsRead && len(cols) > 0 && hosts.QueryType == "" && !isSelectJSON(cols) {
+               name := hosts.TimeColumn
+               if name == "" && hosts.isBuilder() {
+                   name = hosts.Builder.TimeColumn
+               }
+               var typ string
+               if timeColumn, typ, err = detectTimeColumn(cols, name, convertsTimeUUIDs(hosts.TimeUUIDFormat)); err == nil && timeColumn != "" {
+                   if _, ok := converters[timeColumn]; !ok {
+                       var cv columnConverter
+                       if cv, ok, err = timeConverter(timeColumn, typ, hosts.TimeUnit); ok {
+                           converters[timeColumn] = cv
+                       }
+                   }
+               }
+               if err != nil {
+                   iter.Close()
+                   response.Error = err
+                   return response
+               }
+           }
+           if !columnsRead && len(cols) > 0 {
+               columnsRead = true
+               selectJSON = isSelectJSON(cols)
+               for _, c := range cols {
+                   if cast, ok := hosts.ColumnTypes[c.Name]; ok {
+                       cv, ok, err := castConverter(c.Name, c.TypeInfo.Type().String(), cast, hosts.TimeUnit)
+                       if err != nil {
+                           iter.Close()
+                           response.Error = err
+                           return response
+                       }
+                       if ok {
+                           converters[c.Name] = cv
+                       }
+                       continue
+                   }
+                   if _, ok := converters[c.Name]; !ok {
+                       if cv, ok := collectionConverter(c.TypeInfo, hosts.CollectionFormat); ok {
+                           converters[c.Name] = cv
+                       } else if cv, ok := decimalConverter(c.TypeInfo, decimalFormat); ok {
+                           converters[c.Name] = cv
+                           if decimalFormat == "both" {
+                               decimalColumns = append(decimalColumns, c.Name)
+                           }
+                       } else if cv, ok := blobConverter(c.TypeInfo, hosts.BlobFormat); ok {
+                           converters[c.Name] = cv
+                       } else if cv, ok := timeUUIDConverter(c.Name, c.TypeInfo, hosts.TimeUUIDFormat); ok {
+                           converters[c.Name] = cv
+                       } else if cv, ok := customConverter(c.TypeInfo); ok {
+                           converters[c.Name] = cv
+                       }
+                   }
+               }
+               raw = newRawColumns(cols, &hosts)
                for _, c := range iter.Columns() {
-                    frame.Fields = append(frame.Fields,
-                        data.NewField(c.Name, nil, getTypeArray(c.TypeInfo.Type().String())),
-                    )
+                    typ := c.TypeInfo.Type().String()
+                    if cv, ok := converters[c.Name]; ok {
+                        typ = cv.typ
+                    }
+                    field := data.NewField(c.Name, nil, getTypeArray(typ))
+                    field.Config = typeFieldConfig(typ)
+                    frame.Fields = append(frame.Fields, field)
                 }
                 if addHost {
                     frame.Fields = append(frame.Fields,
@@ -202,29 +628,288 @@ func (td *SampleDatasource) query(ctx context.Context, instance *instanceSetting
                     )
                 }
             }
+            scratch := getRowScratch(cols, numCols)
+            dests, vals := scratch.dests, scratch.vals
             for {
-                // New map each iteration
-                row := make(map[string]interface{})
-                if !iter.MapScan(row) {
+                if payloads != nil && iter.WillSwitchPage() {
+                    payloads.add(iter)
+                }
+                if iter.WillSwitchPage() && ctx.Err() != nil {
+                    // the request was aborted, do not fetch the next page
+                    break
+                }
+                if !iter.Scan(dests...) {
+                    break
+                }
+                if maxRows > 0 && filled >= maxRows {
+                    // there are more rows than the limit
+                    truncated = true
                     break
                 }
-                vals := make([]interface{}, numCols)
                 for i, c := range cols {
-                    vals[i] = toValue(row[c.Name], c.TypeInfo.Type().String())
+                    val := scratch.value(i)
+                    if val == nil {
+                        // NULL, the field value is left nil
+                        vals[i] = nil
+                        continue
+                    }
+                    if cv, ok := converters[c.Name]; ok {
+                        vals[i] = cv.convert(val)
+                        continue
+                    }
+                    vals[i] = interner.intern(i, toValue(val, c.TypeInfo.Type().String()))
                 }
-                log.DefaultLogger.Debug("adding vals", "vals", vals)
                 if addHost {
                     vals[numCols - 1] = specificHost
                 }
-                frame.AppendRow(vals...)
+                if sink != nil && filled-flushed == frame.Rows() && frame.Rows() > 0 {
+                    // a new page was fetched, stream the rows of the previous one
+                    if frame, err = streamPage(sink, frame, raw, decimalColumns, selectJSON, hosts.JSONFields); err != nil {
+                        putRowScratch(scratch)
+                        iter.Close()
+                        response.Error = err
+                        return response
+                    }
+                    flushed = filled
+                }
+                if raw != nil {
+                    raw.add(scratch)
+                }
+                if filled-flushed == frame.Rows() {
+                    // a new page was fetched, allocate its rows at once
+                    growFrame(frame, iter.NumRows(), filled, maxRows)
+                }
+                for i, v := range vals {
+                    if v != nil {
+                        frame.SetConcrete(i, filled-flushed, v)
+                    }
+                }
+                filled++
+            }
+            putRowScratch(scratch)
+            frame = trimFrame(frame, filled-flushed)
+            since(&timings.convert, start)
+            warnings = append(warnings, iter.Warnings()...)
+            if payloads != nil {
+                payloads.add(iter)
+            }
+            closeErr := iter.Close()
+            coordinatorHost := coordinator(iter, strings.TrimSpace(specificHost))
+            if closeErr != nil {
+                log.DefaultLogger.Warn(closeErr.Error())
+                instance.errors.add(query.RefID, closeErr)
+                subErrors.add(coordinatorHost, closeErr)
+            }
+            instance.logQuery(query.RefID, coordinatorHost, querytxt, time.Since(hostStart), filled-hostFirstRow, closeErr)
+            if err := ctx.Err(); err != nil {
+                // the request was aborted, skip the remaining hosts
+                response.Error = err
+                return response
             }
-            if err := iter.Close(); err != nil {
-                log.DefaultLogger.Warn(err.Error())
+        }
+        if subErrors.failed() {
+            response.Error = subErrors.err()
+            return response
+        }
+        if len(subErrors.errors) > 0 {
+            frame.AppendNotices(subErrors.notices()...)
+        }
+        instance.warm.record(querytxt, len(args) > 0)
+        if len(hosts.ColumnTypes) > 0 {
+            frame.AppendNotices(missingColumnTypes(frame, hosts.ColumnTypes)...)
+        }
+        if raw != nil {
+            raw.expand(frame)
+        }
+        addDecimalFloats(frame, decimalColumns)
+        if selectJSON {
+            expandSelectJSON(frame)
+            if hosts.QueryType == "" {
+                timeColumn = selectJSONTimeColumn(frame, hosts.TimeColumn)
+            }
+        }
+        if len(warnings) > 0 {
+            frame.AppendNotices(warningNotices(warnings)...)
+        }
+        if truncated {
+            frame.AppendNotices(data.Notice{
+                Severity: data.NoticeSeverityWarning,
+                Text: fmt.Sprintf("results truncated at %d rows", maxRows),
+            })
+        }
+        if sampled > 0 && filled >= sampled {
+            frame.AppendNotices(data.Notice{
+                Severity: data.NoticeSeverityInfo,
+                Text: fmt.Sprintf("Explore reads the first %d rows of queries without a LIMIT, set fullResult to read every row", sampled),
+            })
+        }
+        if sink != nil {
+            // the rows are streamed as they are read, the options on the whole result do not apply
+            if len(hosts.JSONFields) > 0 && len(frame.Fields) > 0 {
+                extractJSONFields(frame, hosts.JSONFields)
             }
+            response.Error = sink(frame)
+            return response
         }
     }
+	if hosts.QueryType == cdcQueryType && frame.Rows() > 0 {
+	   frame = sortCDCEvents(frame)
+	}
+	reversed := false
+	logs := hosts.Format == logsFormat
+	if hasQuery && hosts.QueryType == "" && hosts.FieldOrder != "query" && len(frame.Fields) > 1 {
+	   if columns := instance.queryTableColumns(querytxt); columns != nil {
+	       keysFirst(frame, columns)
+	   }
+	}
+	if timeColumn != "" {
+	   timeFirst(frame, timeColumn)
+	}
+	if hasQuery && hosts.QueryType == "" && !hosts.KeepOrder && !logs && frame.Rows() > 1 && !orderByClause.MatchString(querytxt) {
+	   if descending := instance.descendingTimeColumns(querytxt); descending != nil {
+	       frame, reversed = ascendingTime(frame, descending)
+	   }
+	}
+	if hasQuery && hosts.QueryType == "" && hosts.sortRowsByTime() && !logs && frame.Rows() > 1 {
+	   // CQL only orders the rows of a partition
+	   if idx := timeFieldIndex(frame); idx >= 0 {
+	       frame = sortByTime(frame, idx)
+	   }
+	}
+	if len(hosts.JSONFields) > 0 && len(frame.Fields) > 0 {
+	   if err := extractJSONFields(frame, hosts.JSONFields); err != nil {
+	       frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: err.Error()})
+	   }
+	}
+	if logs {
+	   // log lines are never aggregated
+	} else if bucket != nil {
+	   if downsampled, err := downsample(frame, bucket, hosts.BucketAggregation); err != nil {
+	       frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: err.Error()})
+	   } else {
+	       frame = downsampled
+	   }
+	} else if query.MaxDataPoints > 0 && int64(frame.Rows()) > query.MaxDataPoints && !hosts.RawPoints &&
+	   !isVariableQueryType(hosts.QueryType) && hosts.QueryType != distinctQueryType &&
+	   frame.TimeSeriesSchema().Type != data.TimeSeriesTypeNot {
+	   // more points than the panel can draw, average them per bucket instead of sending them all to the browser
+	   rows := frame.Rows()
+	   fit := maxDataPointsBucket(query.TimeRange.From, query.TimeRange.To, query.MaxDataPoints, query.Interval)
+	   if downsampled, err := downsample(frame, fit, hosts.BucketAggregation); err == nil {
+	       frame = downsampled
+	       frame.AppendNotices(data.Notice{
+	           Severity: data.NoticeSeverityInfo,
+	           Text: fmt.Sprintf("downsampled from %d to %d rows to fit %d data points, set rawPoints to keep every row", rows, frame.Rows(), query.MaxDataPoints),
+	       })
+	   }
+	}
+	if hasQuery {
+	   if frame.Meta == nil {
+	       frame.Meta = &data.FrameMeta{}
+	   }
+	   frame.Meta.ExecutedQueryString = redactQuery(querytxt, hosts.TemplateVariables)
+	   frame.Meta.Stats = append(frame.Meta.Stats, timings.stats()...)
+	   frame.Meta.Stats = append(frame.Meta.Stats, interner.stats()...)
+	   var traces []queryTrace
+	   if tracer != nil {
+	       traces = instance.fetchTraces(ctx, tracer.ids)
+	   }
+	   frame.Meta.Custom = queryMeta{
+	       TimeRange: &metaTimeRange{
+	           From: query.TimeRange.From.UTC().Format(time.RFC3339Nano),
+	           To: query.TimeRange.To.UTC().Format(time.RFC3339Nano),
+	       },
+	       Macros: macros,
+	       Variables: redactVariables(hosts.TemplateVariables),
+	       BoundValues: args,
+	       Reversed: reversed,
+	       Traces: traces,
+	       CustomPayload: payloads,
+	       Errors: subErrors.errors,
+	   }
+	}
 	// create data frame response
 	// add the frames to the response
+	if hasQuery && frame.Rows() == 0 && hosts.QueryType != "query" && hosts.QueryType != distinctQueryType {
+	   mode := hosts.EmptyResult
+	   if mode == "" {
+	       mode = instance.settings.EmptyResult
+	   }
+	   if err := checkEmptyResultMode(mode); err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   response.Frames = append(response.Frames, emptyResultFrames(frame, mode)...)
+	   return response
+	}
+	if hosts.QueryType == distinctQueryType {
+	   values := variableFrame(distinctFieldValues(frame, distinctColumn))
+	   values.Meta = frame.Meta
+	   response.Frames = append(response.Frames, values)
+	   return response
+	}
+	if hosts.QueryType == "query" {
+	   values := variableFrame(variableValues(frame))
+	   values.Meta = frame.Meta
+	   response.Frames = append(response.Frames, values)
+	   return response
+	}
+	if logs {
+	   lines, err := logsFrame(frame, hosts.Logs)
+	   if err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   response.Frames = append(response.Frames, lines)
+	   return response
+	}
+	if hosts.DualFormat {
+	   response.Frames = append(response.Frames, dualFormatFrames(frame)...)
+	   return response
+	}
+	if len(hosts.PartitionBy) > 0 {
+	   parts, err := partitionFrames(frame, hosts.PartitionBy)
+	   if err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   for _, part := range parts {
+	       if hosts.Format != "" {
+	           if part, err = formatFrame(part, hosts.Format, fill); err != nil {
+	               response.Error = err
+	               return response
+	           }
+	       }
+	       response.Frames = append(response.Frames, part)
+	   }
+	   return response
+	}
+	if len(hosts.LabelColumns) > 0 {
+	   wide, err := pivotLabels(frame, hosts.LabelColumns, fill)
+	   if err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   response.Frames = append(response.Frames, wide)
+	   return response
+	}
+	if hosts.ConvertToWide {
+	   wide, err := toTimeSeries(frame, fill)
+	   if err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   response.Frames = append(response.Frames, wide)
+	   return response
+	}
+	if hosts.Format != "" {
+	   formatted, err := formatFrame(frame, hosts.Format, fill)
+	   if err != nil {
+	       response.Error = err
+	       return response
+	   }
+	   frame = formatted
+	}
 	response.Frames = append(response.Frames, frame)
 
 	return response
@@ -238,16 +923,113 @@ func (td *SampleDatasource) CheckHealth(ctx context.Context, req *backend.CheckH
 	var status = backend.HealthStatusOk
 	var message = "Data source is working"
 
+	instSetting, err := td.checkConnection(ctx, req.PluginContext)
+	if err != nil {
+		log.DefaultLogger.Info("Health check failed", "err", err)
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: withHint(err).Error(),
+		}, nil
+	}
+	if instSetting.tlsConfig == nil {
+		return &backend.CheckHealthResult{
+			Status:  status,
+			Message: message,
+		}, nil
+	}
+	// report the server certificate expiry so it is renewed before dashboards break
+	var certs []*certificateExpiry
+	expiring := false
+	for _, host := range splitList(instSetting.settings.Host) {
+		cert, err := instSetting.probeCertificate(host)
+		if err != nil {
+			log.DefaultLogger.Info("Unable to read the server certificate", "host", host, "err", err)
+			continue
+		}
+		certs = append(certs, cert)
+		if cert.ExpiresSoon && !expiring {
+			// there is no warning status, the connection works so the check still passes
+			expiring = true
+			message = fmt.Sprintf("Data source is working, but the TLS certificate of %s expires in %d days (%s)",
+				cert.Host, cert.DaysUntilExpiry, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	if !expiring && len(certs) > 0 {
+		message = fmt.Sprintf("%s, the TLS certificate expires in %d days", message, certs[0].DaysUntilExpiry)
+	}
+	details, err := json.Marshal(map[string]interface{}{"certificates": certs})
+	if err != nil {
+		return nil, err
+	}
 	return &backend.CheckHealthResult{
-		Status:  status,
-		Message: message,
+		Status:      status,
+		Message:     message,
+		JSONDetails: details,
 	}, nil
 }
 
+// checkConnection connects to the cluster and runs a trivial query, on the
+// health check session.
+func (td *SampleDatasource) checkConnection(ctx context.Context, pluginContext backend.PluginContext) (*instanceSettings, error) {
+	instance, err := td.im.Get(pluginContext)
+	if err != nil {
+		return nil, err
+	}
+	instSetting, ok := instance.(*instanceSettings)
+	if !ok {
+		return nil, errors.New("unexpected datasource instance type")
+	}
+	instSetting.touch()
+	session, err := instSetting.healthSession()
+	if err != nil {
+		return nil, err
+	}
+	var version string
+	return instSetting, session.Query("SELECT release_version FROM system.local").WithContext(ctx).Scan(&version)
+}
+
+// checkQuery verifies the query is permitted by the keyspace restrictions
+// and the query rules of the datasource.
+func (settings *instanceSettings) checkQuery(query string) error {
+    if err := settings.keyspaces.check(query); err != nil {
+        return err
+    }
+    return settings.rules.check(query)
+}
+
 type instanceSettings struct {
     cluster *gocql.ClusterConfig
     authenticator *gocql.PasswordAuthenticator
+    // monitorAuthenticator is the credential of the health checks, the query credential when it is not set
+    monitorAuthenticator *gocql.PasswordAuthenticator
+    options clusterOptions
+    mu sync.Mutex
     sessions map[string]*gocql.Session
+    keyspaces *keyspaceFilter
+    rewrites []compiledRewriteRule
+    rules *queryRules
+    settings editModel
+    errors *errorLog
+    schema *schemaCache
+    tlsConfig *tls.Config
+    templates map[string]queryTemplate
+    warm *warmSet
+    contactPoints *contactPoints
+    results *resultCache
+    limiter *dashboardLimiter
+    running *runningQueries
+    // health is the session of the health checks, apart from the query sessions
+    healthMu sync.Mutex
+    health *gocql.Session
+    // name is the datasource name the metrics are labeled with
+    name string
+    // secrets are the secure settings scrubbed from the log until the instance is disposed
+    secrets []string
+    openSessions int32
+    // disposed is set under mu when the instance is disposed, sessions connected after it are closed
+    disposed bool
+    // lastUsed is the time, in unix nanoseconds, of the last query, health check or resource call
+    lastUsed int64
 }
 
 func (settings *instanceSettings) getSession(hostRef interface{}) (*gocql.Session, error) {
@@ -268,72 +1050,293 @@ func (settings *instanceSettings) getSession(hostRef interface{}) (*gocql.Sessio
     if hostRef != nil {
         host = fmt.Sprintf("%v", hostRef)
     }
+    settings.mu.Lock()
     if val, ok := settings.sessions[host]; ok {
+        settings.mu.Unlock()
         return val, nil
     }
     if settings.cluster == nil {
         if host == "" {
+            settings.mu.Unlock()
             return nil, errors.New("no host supplied for connection")
         }
-        settings.cluster = gocql.NewCluster(host)
+        settings.cluster = settings.newCluster(host)
         log.DefaultLogger.Debug("getSession creating cluster from host", "host", host)
-        if settings.authenticator != nil {
-            settings.cluster.Authenticator = *settings.authenticator
-        }
     }
     log.DefaultLogger.Debug("getSession", "host", host)
+    if err := settings.reserveSession(); err != nil {
+        settings.mu.Unlock()
+        return nil, err
+    }
+    cluster := *settings.cluster
+    settings.mu.Unlock()
     if host == "" {
-        settings.cluster.HostFilter = nil
+        cluster.HostFilter = nil
     } else {
-        settings.cluster.HostFilter = gocql.WhiteListHostFilter(host)
+        cluster.HostFilter = gocql.WhiteListHostFilter(host)
     }
-    session, err := gocql.NewSession(*settings.cluster)
+    // the session is connected without holding settings.mu, so a slow or
+    // unreachable cluster does not hold up the queries of other sessions
+    session, err := settings.connect(cluster, host)
     if err != nil {
-        log.DefaultLogger.Info("unable to connect to scylla", "err", err, "session", session, "host", host)
-        return nil, err
+        log.DefaultLogger.Info("unable to connect to scylla", "err", err, "host", host)
+        settings.releaseSession()
+        return nil, settings.transportHint(err)
+    }
+    settings.mu.Lock()
+    defer settings.mu.Unlock()
+    if val, ok := settings.sessions[host]; ok || settings.disposed {
+        // another query connected meanwhile, keep its session, or the instance was disposed
+        session.Close()
+        settings.releaseSession()
+        if !ok {
+            return nil, errors.New("the datasource settings changed while connecting, run the query again")
+        }
+        return val, nil
     }
     settings.sessions[host] = session
     return session, nil
 }
 
-func newDataSourceInstance(setting backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
-    type editModel struct {
-        Host string `json:"host"`
+// connect opens a session of the cluster, for the default session through
+// the fastest contact point once their latencies are measured, falling back
+// to every contact point.
+func (settings *instanceSettings) connect(cluster gocql.ClusterConfig, host string) (*gocql.Session, error) {
+    if host == "" {
+        if fastest, ok := settings.contactPoints.fastest(); ok {
+            // the driver picks the control connection host at random, only give it the fastest one
+            hosts := cluster.Hosts
+            cluster.Hosts = []string{fastest}
+            cluster.PoolConfig.HostSelectionPolicy = settings.hostSelectionPolicy()
+            if session, err := gocql.NewSession(cluster); err == nil {
+                return session, nil
+            }
+            log.DefaultLogger.Info("unable to connect through the fastest contact point", "host", fastest)
+            cluster.Hosts = hosts
+        }
     }
+    cluster.PoolConfig.HostSelectionPolicy = settings.hostSelectionPolicy()
+    return gocql.NewSession(cluster)
+}
+
+// editModel holds the datasource settings configured in JSONData.
+type editModel struct {
+    Host string `json:"host"`
+    AllowedKeyspaces string `json:"allowedKeyspaces"`
+    DeniedKeyspaces string `json:"deniedKeyspaces"`
+    Consistency string `json:"consistency"`
+    SchemaCacheTTL string `json:"schemaCacheTTL"`
+    LocalDatacenter string `json:"localDatacenter"`
+    Timeout string `json:"timeout"`
+    ConnectTimeout string `json:"connectTimeout"`
+    ProtoVersion int `json:"protoVersion"`
+    Compression string `json:"compression"`
+    NumConns int `json:"numConns"`
+    RetryPolicy string `json:"retryPolicy"`
+    RetryCount int `json:"retryCount"`
+    RetryMinInterval string `json:"retryMinInterval"`
+    RetryMaxInterval string `json:"retryMaxInterval"`
+    SpeculativeAttempts int `json:"speculativeAttempts"`
+    SpeculativeDelay string `json:"speculativeDelay"`
+    RewriteRules []rewriteRule `json:"rewriteRules"`
+    QueryAllowPatterns []string `json:"queryAllowPatterns"`
+    QueryDenyPatterns []string `json:"queryDenyPatterns"`
+    AllowedTables string `json:"allowedTables"`
+    DeniedTables string `json:"deniedTables"`
+    DisableTokenAware bool `json:"disableTokenAware"`
+    TLS bool `json:"tls"`
+    TLSSkipVerify bool `json:"tlsSkipVerify"`
+    // AdHocTable is the keyspace.table ad-hoc filters list their keys and values from
+    AdHocTable string `json:"adHocTable"`
+    QueryTemplates []queryTemplate `json:"queryTemplates"`
+    EmptyResult string `json:"emptyResult"`
+    // DecimalFormat is how varint and decimal columns are returned: float (the default), string or both
+    DecimalFormat string `json:"decimalFormat"`
+    // QueryLogLevel is the level the executed queries are logged at: debug (the default), info or off
+    QueryLogLevel string `json:"queryLogLevel"`
+    MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+    PageSize int `json:"pageSize"`
+    MaxRows int `json:"maxRows"`
+    // CacheDir is a directory where the recently used tables and statements are kept across restarts
+    CacheDir string `json:"cacheDir"`
+    LatencyProbeInterval string `json:"latencyProbeInterval"`
+    ResultCacheTTL string `json:"resultCacheTTL"`
+    ResultCacheSize int `json:"resultCacheSize"`
+    // AnnotationsTable is the keyspace.table annotations created in Grafana are written to
+    AnnotationsTable string `json:"annotationsTable"`
+    // AnnotationsRole is the lowest organization role allowed to write annotations
+    AnnotationsRole string `json:"annotationsRole"`
+    // DashboardQueryRate is the queries per second shared fairly between the dashboards using the datasource
+    DashboardQueryRate float64 `json:"dashboardQueryRate"`
+    DashboardQueryBurst int `json:"dashboardQueryBurst"`
+    // ExploreLimit is the LIMIT added to Explore queries without one, negative to not limit them
+    ExploreLimit int `json:"exploreLimit"`
+    // ProbeTransport probes whether the server speaks TLS or plaintext when connecting fails
+    ProbeTransport bool `json:"probeTransport"`
+    // MonitoringLinks link the query results to the Scylla Monitoring dashboards of the table they read
+    MonitoringLinks []monitoringLink `json:"monitoringLinks"`
+    // MaxSessions bounds the driver sessions the datasource opens, a session per queryHost host and one for health checks
+    MaxSessions int `json:"maxSessions"`
+    // IdleTimeout is how long the datasource is unused before its sessions and caches are released, 0 to keep them
+    IdleTimeout string `json:"idleTimeout"`
+    // MemoryBudgetMB bounds the memory the caches of the datasource hold, they are shrunk when it is exceeded
+    MemoryBudgetMB int `json:"memoryBudgetMB"`
+}
+
+func newDataSourceInstance(setting backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
     var hosts editModel
     log.DefaultLogger.Debug("newDataSourceInstance", "data", setting.JSONData)
     var secureData = setting.DecryptedSecureJSONData
+    secrets := registerSecrets(secureData)
+    var instance *instanceSettings
+    defer func() {
+        if instance == nil {
+            // the settings are rejected, no instance holds the secrets
+            unregisterSecrets(secrets)
+        }
+    }()
     err := json.Unmarshal(setting.JSONData, &hosts)
     if err != nil {
         log.DefaultLogger.Warn("error marsheling", "err", err)
         return nil, err
     }
+    if err := validateSettings(hosts, secureData); err != nil {
+        log.DefaultLogger.Error("Rejecting datasource settings", "datasource", setting.Name, "err", err)
+        return nil, err
+    }
     log.DefaultLogger.Info("looking for host", "host", hosts.Host)
-    var newCluster *gocql.ClusterConfig = nil
     var authenticator *gocql.PasswordAuthenticator = nil
     password, hasPassword := secureData["password"]
     user, hasUser := secureData["user"]
     if hasPassword && hasUser {
-        log.DefaultLogger.Debug("using username and password", "user", user)
+        log.DefaultLogger.Debug("using password authentication", "datasource", setting.Name)
         authenticator = &gocql.PasswordAuthenticator{
             Username: user,
             Password: password,
         }
     }
-    if hosts.Host != "" {
-        newCluster = gocql.NewCluster(hosts.Host)
-        if authenticator != nil {
-            newCluster.Authenticator = *authenticator
+    var monitorAuthenticator *gocql.PasswordAuthenticator
+    if monitorUser, ok := secureData["monitorUser"]; ok {
+        monitorAuthenticator = &gocql.PasswordAuthenticator{
+            Username: monitorUser,
+            Password: secureData["monitorPassword"],
         }
     }
-	return &instanceSettings{
-		cluster: newCluster,
+    options, err := parseClusterOptions(hosts)
+    if err != nil {
+        log.DefaultLogger.Warn("invalid connection settings", "err", err)
+        return nil, err
+    }
+    schemaTTL, err := parseDuration("schemaCacheTTL", hosts.SchemaCacheTTL, defaultSchemaCacheTTL)
+    if err != nil {
+        log.DefaultLogger.Warn("invalid schema cache ttl", "err", err)
+        return nil, err
+    }
+    rewrites, err := compileRewriteRules(hosts.RewriteRules)
+    if err != nil {
+        return nil, err
+    }
+    rules, err := newQueryRules(hosts)
+    if err != nil {
+        return nil, err
+    }
+    tlsConfig, err := buildTLSConfig(hosts, secureData)
+    if err != nil {
+        return nil, err
+    }
+    templates, err := compileQueryTemplates(hosts.QueryTemplates)
+    if err != nil {
+        return nil, err
+    }
+    resultTTL, err := parseDuration("resultCacheTTL", hosts.ResultCacheTTL, 0)
+    if err != nil {
+        return nil, err
+    }
+	instance = &instanceSettings{
 		authenticator: authenticator,
+		monitorAuthenticator: monitorAuthenticator,
+		options: options,
 		sessions: make(map[string]*gocql.Session),
-	}, nil
+		keyspaces: newKeyspaceFilter(hosts.AllowedKeyspaces, hosts.DeniedKeyspaces),
+		rewrites: rewrites,
+		rules: rules,
+		settings: hosts,
+		errors: newErrorLog(maxRecentErrors),
+		schema: newSchemaCache(schemaTTL),
+		tlsConfig: tlsConfig,
+		templates: templates,
+		results: newResultCache(resultTTL, hosts.ResultCacheSize),
+		limiter: newDashboardLimiter(hosts.DashboardQueryRate, hosts.DashboardQueryBurst),
+		running: newRunningQueries(),
+		name: setting.Name,
+		secrets: secrets,
+	}
+	instance.schema.version = instance.schemaVersion
+    if hosts.Host != "" {
+        instance.contactPoints = newContactPoints(splitList(hosts.Host), options.latencyProbeInterval)
+        instance.cluster = instance.newCluster(splitList(hosts.Host)...)
+        instance.contactPoints.watch(instance.reconnectFastest)
+        if hosts.CacheDir != "" {
+            instance.warm = loadWarmSet(warmSetPath(hosts.CacheDir, setting.ID))
+            go instance.warmUp()
+        }
+    }
+	registerInstance(instance)
+	return instance, nil
 }
 
 func (s *instanceSettings) Dispose() {
 	// Called before creatinga a new instance to allow plugin authors
 	// to cleanup.
+	unregisterInstance(s)
+	s.contactPoints.close()
+	s.mu.Lock()
+	s.disposed = true
+	s.mu.Unlock()
+	s.closeSessions()
+}
+
+// reconnectFastest replaces the default session when another contact point is
+// the fastest, so its control connection goes through it.
+func (s *instanceSettings) reconnectFastest(fastest string) {
+	s.mu.Lock()
+	session, ok := s.sessions[""]
+	delete(s.sessions, "")
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	log.DefaultLogger.Info("fastest contact point changed, reconnecting", "host", fastest)
+	time.AfterFunc(sessionDrainDelay, func() {
+		session.Close()
+		s.releaseSession()
+	})
+}
+
+// closeSessions closes the query and health check sessions, queries open
+// them again.
+func (s *instanceSettings) closeSessions() {
+	s.mu.Lock()
+	s.closeQuerySessions()
+	s.mu.Unlock()
+	s.closeHealthSession()
+}
+
+// closeQuerySessions closes the query sessions, s.mu must be held.
+func (s *instanceSettings) closeQuerySessions() {
+	for host, session := range s.sessions {
+		session.Close()
+		s.releaseSession()
+		delete(s.sessions, host)
+	}
+}
+
+func (s *instanceSettings) closeHealthSession() {
+	s.healthMu.Lock()
+	if s.health != nil {
+		s.health.Close()
+		s.releaseSession()
+		s.health = nil
+	}
+	s.healthMu.Unlock()
 }
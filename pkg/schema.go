@@ -0,0 +1,266 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// defaultSchemaCacheTTL is used when schemaCacheTTL is not configured.
+const defaultSchemaCacheTTL = 30 * time.Second
+
+// schemaVersionInterval is how often lookups check the schema version of
+// the cluster, which invalidates the cache when it changed.
+const schemaVersionInterval = 2 * time.Second
+
+// columnInfo describes a table column as stored in system_schema.columns.
+type columnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Kind     string `json:"kind"`
+	Position int    `json:"position"`
+	// ClusteringOrder is asc or desc for clustering columns, none otherwise
+	ClusteringOrder string `json:"clusteringOrder"`
+}
+
+type schemaEntry struct {
+	value      interface{}
+	err        error
+	fetched    time.Time
+	loading    chan struct{}
+	refreshing bool
+}
+
+// schemaCache caches system_schema lookups. Entries older than the ttl are
+// still returned while they are refreshed in the background, so only the
+// first lookup of a key waits for Scylla. Concurrent lookups of a key that
+// is not cached yet share a single query.
+//
+// The driver does not expose the schema change events it receives, so when
+// version is set lookups compare the cluster schema version at most every
+// schemaVersionInterval and drop all the entries when it changed, e.g. once
+// a table was created.
+type schemaCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*schemaEntry
+
+	version   func() (string, error)
+	versionMu sync.Mutex
+	checked   time.Time
+	current   string
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{
+		ttl:     ttl,
+		entries: make(map[string]*schemaEntry),
+	}
+}
+
+func (c *schemaCache) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	c.checkVersion()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &schemaEntry{loading: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+		c.fill(key, entry, load)
+		return entry.value, entry.err
+	}
+	if loading := entry.loading; loading != nil {
+		c.mu.Unlock()
+		<-loading
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return entry.value, entry.err
+	}
+	defer c.mu.Unlock()
+	if entry.err != nil {
+		// failures are not kept, the next lookup retries
+		delete(c.entries, key)
+		return entry.value, entry.err
+	}
+	if time.Since(entry.fetched) > c.ttl && !entry.refreshing {
+		entry.refreshing = true
+		go c.refresh(key, entry, load)
+	}
+	return entry.value, nil
+}
+
+func (c *schemaCache) fill(key string, entry *schemaEntry, load func() (interface{}, error)) {
+	value, err := load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.value, entry.err, entry.fetched = value, err, time.Now()
+	close(entry.loading)
+	entry.loading = nil
+}
+
+func (c *schemaCache) refresh(key string, entry *schemaEntry, load func() (interface{}, error)) {
+	value, err := load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refreshing = false
+	if err != nil {
+		log.DefaultLogger.Warn("Failed refreshing schema cache", "key", key, "err", err)
+		return
+	}
+	entry.value, entry.fetched = value, time.Now()
+}
+
+// checkVersion invalidates the cache when the schema version changed since
+// the last check.
+func (c *schemaCache) checkVersion() {
+	if c.version == nil {
+		return
+	}
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	if time.Since(c.checked) < schemaVersionInterval {
+		return
+	}
+	c.checked = time.Now()
+	version, err := c.version()
+	if err != nil {
+		log.DefaultLogger.Debug("Failed reading the schema version", "err", err)
+		return
+	}
+	if c.current != "" && version != c.current {
+		log.DefaultLogger.Debug("Schema changed, invalidating the schema cache", "version", version)
+		c.invalidate()
+	}
+	c.current = version
+}
+
+// invalidate drops all the cached entries.
+func (c *schemaCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*schemaEntry)
+}
+
+// size returns the number of cached entries.
+func (c *schemaCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// schemaVersion returns the schema version of the cluster, which changes
+// with every schema change.
+func (settings *instanceSettings) schemaVersion() (string, error) {
+	session, err := settings.getSession("")
+	if err != nil {
+		return "", err
+	}
+	var version gocql.UUID
+	if err := session.Query("SELECT schema_version FROM system.local").Scan(&version); err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+// schemaStrings runs a system_schema query returning a single text column.
+func (settings *instanceSettings) schemaStrings(stmt string, values ...interface{}) ([]string, error) {
+	session, err := settings.getSession("")
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	var name string
+	iter := session.Query(stmt, values...).Iter()
+	for iter.Scan(&name) {
+		res = append(res, name)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// schemaKeyspaces returns the keyspaces the instance may query.
+func (settings *instanceSettings) schemaKeyspaces() ([]string, error) {
+	v, err := settings.schema.get("keyspaces", func() (interface{}, error) {
+		return settings.schemaStrings("SELECT keyspace_name FROM system_schema.keyspaces")
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, ks := range v.([]string) {
+		if settings.keyspaces.checkKeyspace(`"`+ks+`"`) == nil {
+			res = append(res, ks)
+		}
+	}
+	return res, nil
+}
+
+// schemaTables returns the tables of a keyspace.
+func (settings *instanceSettings) schemaTables(keyspace string) ([]string, error) {
+	if err := settings.keyspaces.checkKeyspace(`"` + keyspace + `"`); err != nil {
+		return nil, err
+	}
+	v, err := settings.schema.get("tables/"+keyspace, func() (interface{}, error) {
+		return settings.schemaStrings("SELECT table_name FROM system_schema.tables WHERE keyspace_name = ?", keyspace)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// schemaColumns returns the columns of a table ordered as partition keys,
+// clustering keys and then regular columns.
+func (settings *instanceSettings) schemaColumns(keyspace string, table string) ([]columnInfo, error) {
+	if err := settings.keyspaces.checkKeyspace(`"` + keyspace + `"`); err != nil {
+		return nil, err
+	}
+	v, err := settings.schema.get("columns/"+keyspace+"/"+table, func() (interface{}, error) {
+		session, err := settings.getSession("")
+		if err != nil {
+			return nil, err
+		}
+		var res []columnInfo
+		var c columnInfo
+		iter := session.Query("SELECT column_name, type, kind, position, clustering_order FROM system_schema.columns WHERE keyspace_name = ? AND table_name = ?",
+			keyspace, table).Iter()
+		for iter.Scan(&c.Name, &c.Type, &c.Kind, &c.Position, &c.ClusteringOrder) {
+			res = append(res, c)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		sortColumns(res)
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]columnInfo), nil
+}
+
+var columnKindOrder = map[string]int{
+	"partition_key": 0,
+	"clustering":    1,
+	"static":        2,
+	"regular":       3,
+}
+
+func sortColumns(columns []columnInfo) {
+	sort.SliceStable(columns, func(i, j int) bool {
+		ki, kj := columnKindOrder[columns[i].Kind], columnKindOrder[columns[j].Kind]
+		if ki != kj {
+			return ki < kj
+		}
+		if columns[i].Position != columns[j].Position {
+			return columns[i].Position < columns[j].Position
+		}
+		return columns[i].Name < columns[j].Name
+	})
+}
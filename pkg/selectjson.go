@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// selectJSONColumn is the only column of the result of a SELECT JSON query.
+const selectJSONColumn = "[json]"
+
+// jsonTimeLayouts are the layouts of the timestamps of SELECT JSON results,
+// e.g. 2021-03-04 12:00:00.000Z, and of RFC 3339 text.
+var jsonTimeLayouts = []string{"2006-01-02 15:04:05.999Z07:00", "2006-01-02 15:04:05.999Z0700", time.RFC3339Nano}
+
+// isSelectJSON reports whether the columns are the result of a SELECT JSON query.
+func isSelectJSON(cols []gocql.ColumnInfo) bool {
+	return len(cols) == 1 && cols[0].Name == selectJSONColumn
+}
+
+// decodeJSONRow returns the keys of a JSON object, in order, and their values.
+func decodeJSONRow(text string) ([]string, map[string]interface{}, bool) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, false
+	}
+	var keys []string
+	values := map[string]interface{}{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key, _ := t.(string)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, false
+		}
+		keys = append(keys, key)
+		values[key] = v
+	}
+	return keys, values, true
+}
+
+// jsonTime parses a timestamp of a SELECT JSON result.
+func jsonTime(v interface{}) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range jsonTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// jsonTimeField returns a time field of the values when they are all
+// timestamps, nil otherwise.
+func jsonTimeField(name string, values []interface{}) *data.Field {
+	times := make([]*time.Time, len(values))
+	found := false
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		t, ok := jsonTime(v)
+		if !ok {
+			return nil
+		}
+		times[i] = &t
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return data.NewField(name, nil, times)
+}
+
+// expandSelectJSON replaces the [json] field of a SELECT JSON result by a
+// field per key of the row objects, in the order of the keys. Fields holding
+// only numbers are float64, only booleans bool, only timestamps time, and
+// otherwise text with objects and arrays encoded as JSON. Rows without a key
+// are null.
+func expandSelectJSON(frame *data.Frame) {
+	idx := fieldIndex(frame, selectJSONColumn)
+	if idx < 0 {
+		return
+	}
+	src := frame.Fields[idx]
+	rows := make([]map[string]interface{}, src.Len())
+	var keys []string
+	seen := map[string]bool{}
+	for i := range rows {
+		text, ok := src.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		rowKeys, values, ok := decodeJSONRow(text.(string))
+		if !ok {
+			continue
+		}
+		rows[i] = values
+		for _, key := range rowKeys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	fields := make([]*data.Field, 0, len(frame.Fields)-1+len(keys))
+	fields = append(fields, frame.Fields[:idx]...)
+	for _, key := range keys {
+		values := make([]interface{}, len(rows))
+		numbers, bools := true, true
+		for i, row := range rows {
+			if v := row[key]; v != nil {
+				values[i] = v
+				_, isNumber := v.(float64)
+				_, isBool := v.(bool)
+				numbers, bools = numbers && isNumber, bools && isBool
+			}
+		}
+		field := jsonTimeField(key, values)
+		if field == nil {
+			field = jsonValuesField(key, values, numbers, bools)
+		}
+		fields = append(fields, field)
+	}
+	frame.Fields = append(fields, frame.Fields[idx+1:]...)
+}
+
+// selectJSONTimeColumn returns the time field of an expanded SELECT JSON
+// result: the key named by the query when it is a time field, or else the
+// only time field, empty when there is none or several.
+func selectJSONTimeColumn(frame *data.Frame, name string) string {
+	if name != "" {
+		if idx := fieldIndex(frame, name); idx >= 0 && frame.Fields[idx].Type().Time() {
+			return name
+		}
+		return ""
+	}
+	found := ""
+	for _, f := range frame.Fields {
+		if !f.Type().Time() {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = f.Name
+	}
+	return found
+}
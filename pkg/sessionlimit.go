@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultMaxSessions is the number of sessions an instance may open when maxSessions is not set.
+const defaultMaxSessions = 32
+
+// maxSessionsLimit bounds the maxSessions setting.
+const maxSessionsLimit = 1024
+
+var (
+	openSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scylla_datasource",
+		Name:      "open_sessions",
+		Help:      "The number of open driver sessions of the datasource.",
+	}, []string{"datasource"})
+	rejectedSessions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scylla_datasource",
+		Name:      "rejected_sessions_total",
+		Help:      "The number of sessions not opened because the datasource reached maxSessions.",
+	}, []string{"datasource"})
+)
+
+func init() {
+	// the plugin SDK serves the default registry to Grafana
+	prometheus.MustRegister(openSessions, rejectedSessions)
+}
+
+// maxSessions returns how many sessions, the health check session included,
+// the instance may open.
+func (settings *instanceSettings) maxSessions() int32 {
+	if n := settings.settings.MaxSessions; n > 0 {
+		return int32(n)
+	}
+	return defaultMaxSessions
+}
+
+// reserveSession counts a session about to be opened, or rejects it when
+// the instance has maxSessions open, each session holding connections to
+// the cluster hosts.
+func (settings *instanceSettings) reserveSession() error {
+	if n := atomic.AddInt32(&settings.openSessions, 1); n > settings.maxSessions() {
+		atomic.AddInt32(&settings.openSessions, -1)
+		rejectedSessions.WithLabelValues(settings.name).Inc()
+		return fmt.Errorf("the datasource has %d sessions open, the maxSessions limit, use fewer queryHost hosts or raise maxSessions", n-1)
+	}
+	openSessions.WithLabelValues(settings.name).Inc()
+	return nil
+}
+
+// releaseSession uncounts a session that was closed or failed to open.
+func (settings *instanceSettings) releaseSession() {
+	atomic.AddInt32(&settings.openSessions, -1)
+	openSessions.WithLabelValues(settings.name).Dec()
+}
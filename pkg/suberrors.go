@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// subQueryError is the error of one of the queries a query is split into,
+// e.g. the query of one of the queryHost hosts.
+type subQueryError struct {
+	Host  string `json:"host,omitempty"`
+	Error string `json:"error"`
+}
+
+// subQueryErrors collects the errors of the sub-queries of a query, so a
+// failing host does not hide the others.
+type subQueryErrors struct {
+	total int
+	// keyspace is the keyspace the query reads, named by the errors
+	keyspace string
+	errors   []subQueryError
+}
+
+// add records the error of the sub-query of a host, nil errors are ignored.
+func (e *subQueryErrors) add(host string, err error) {
+	if err == nil {
+		return
+	}
+	e.errors = append(e.errors, subQueryError{Host: host, Error: describeError(err, host, e.keyspace).Error()})
+}
+
+// failed reports whether every sub-query failed.
+func (e *subQueryErrors) failed() bool {
+	return len(e.errors) > 0 && len(e.errors) >= e.total
+}
+
+// err returns the error of a query whose sub-queries all failed, listing
+// the error of each host.
+func (e *subQueryErrors) err() error {
+	if len(e.errors) == 1 {
+		return fmt.Errorf("%s", e.errors[0].Error)
+	}
+	msgs := make([]string, len(e.errors))
+	for i, s := range e.errors {
+		msgs[i] = fmt.Sprintf("host %s: %s", s.Host, s.Error)
+	}
+	return fmt.Errorf("all %d hosts failed: %s", len(e.errors), strings.Join(msgs, "; "))
+}
+
+// notices returns a warning per failed sub-query of a query with results.
+func (e *subQueryErrors) notices() []data.Notice {
+	notices := make([]data.Notice, len(e.errors))
+	for i, s := range e.errors {
+		notices[i] = data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("host %s failed, its rows are missing: %s", s.Host, s.Error),
+		}
+	}
+	return notices
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateParamName matches the name of a :name parameter placeholder of a
+// query template.
+var templateParamName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// queryTemplate is a named, parameterized query registered in the
+// datasource settings, dashboards reference it by name.
+type queryTemplate struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Defaults are the values of the parameters a dashboard does not set
+	Defaults map[string]string `json:"defaults"`
+}
+
+// compileQueryTemplates indexes the configured query templates by name.
+func compileQueryTemplates(templates []queryTemplate) (map[string]queryTemplate, error) {
+	res := make(map[string]queryTemplate, len(templates))
+	for i, t := range templates {
+		if t.Name == "" || t.Query == "" {
+			return nil, fmt.Errorf("query template %d must have a name and a query", i+1)
+		}
+		if _, ok := res[t.Name]; ok {
+			return nil, fmt.Errorf("query template %q is defined twice", t.Name)
+		}
+		res[t.Name] = t
+	}
+	return res, nil
+}
+
+// expand returns the template query with its placeholders replaced by bind
+// markers and the parameter values to bind, in order. Values are bound
+// instead of substituted so a parameter can not change the statement.
+// Placeholders are only looked for in the tokens of the statement, a :name
+// in a string literal or a comment is left as written.
+func (t queryTemplate) expand(params map[string]string) (string, []interface{}, error) {
+	var args []interface{}
+	var missing string
+	var query strings.Builder
+	last, colon := 0, -1
+	err := scanCQL(t.Query, func(token string, start int) {
+		if token == ":" {
+			colon = start
+			return
+		}
+		if colon >= 0 && start == colon+1 && templateParamName.MatchString(token) {
+			value, ok := params[token]
+			if !ok {
+				value, ok = t.Defaults[token]
+			}
+			if !ok && missing == "" {
+				missing = token
+			}
+			args = append(args, value)
+			query.WriteString(t.Query[last:colon])
+			query.WriteString("?")
+			last = start + len(token)
+		}
+		colon = -1
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("query template %q can not be parsed: %v", t.Name, err)
+	}
+	if missing != "" {
+		return "", nil, fmt.Errorf("query template %q requires the %s parameter", t.Name, missing)
+	}
+	query.WriteString(t.Query[last:])
+	return query.String(), args, nil
+}
+
+// templateQuery returns the statement and bound values of a named template.
+func (settings *instanceSettings) templateQuery(name string, params map[string]string) (string, []interface{}, error) {
+	t, ok := settings.templates[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown query template %q", name)
+	}
+	return t.expand(params)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// detectTimeColumn returns the result column used as the time axis: the
+// column named by the query, or else the only timestamp column of the
+// result, or with timeuuids the only timeuuid column when there is no
+// timestamp column. It returns the column name and type, an empty name when
+// there is none or several.
+func detectTimeColumn(cols []gocql.ColumnInfo, name string, timeuuids bool) (string, string, error) {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	if name != "" {
+		name = matchName(name, names)
+		for _, c := range cols {
+			if c.Name == name {
+				return name, c.TypeInfo.Type().String(), nil
+			}
+		}
+		return "", "", fmt.Errorf("time column %s is not a column of the result", name)
+	}
+	found, several := onlyColumn(cols, gocql.TypeTimestamp)
+	if several {
+		return "", "", nil
+	}
+	if found == "" && timeuuids {
+		if found, _ = onlyColumn(cols, gocql.TypeTimeUUID); found != "" {
+			return found, "timeuuid", nil
+		}
+	}
+	return found, "timestamp", nil
+}
+
+// onlyColumn returns the name of the only column of a type, empty when
+// there is none or several, and whether there are several.
+func onlyColumn(cols []gocql.ColumnInfo, typ gocql.Type) (string, bool) {
+	found := ""
+	for _, c := range cols {
+		if c.TypeInfo.Type() != typ {
+			continue
+		}
+		if found != "" {
+			return "", true
+		}
+		found = c.Name
+	}
+	return found, false
+}
+
+// timeConverter returns the converter parsing a time column that is not a
+// timestamp: numbers are epochs in unit (ms by default), text is RFC 3339,
+// and dates and timeuuids are converted to their time. Values that can not
+// be parsed are null.
+func timeConverter(name string, typ string, unit string) (columnConverter, bool, error) {
+	switch typ {
+	case "timestamp":
+		return columnConverter{}, false, nil
+	case "date":
+		return columnConverter{typ: "timestamp", convert: func(val interface{}) interface{} {
+			if t, ok := val.(time.Time); ok {
+				return t
+			}
+			return nil
+		}}, true, nil
+	case "timeuuid":
+		return columnConverter{typ: "timestamp", convert: func(val interface{}) interface{} {
+			if id, ok := val.(gocql.UUID); ok {
+				return id.Time().UTC()
+			}
+			return nil
+		}}, true, nil
+	case "text", "varchar", "ascii":
+		return columnConverter{typ: "timestamp", convert: func(val interface{}) interface{} {
+			s, _ := val.(string)
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t.UTC()
+			}
+			return nil
+		}}, true, nil
+	case "bigint", "int", "smallint", "tinyint", "varint", "counter", "double", "float":
+		if unit == "" {
+			unit = "ms"
+		}
+		if _, ok := epochUnits[unit]; !ok {
+			return columnConverter{}, false, fmt.Errorf("unsupported time unit %q, use one of s, ms, us or ns", unit)
+		}
+		return columnConverter{typ: "timestamp", convert: func(val interface{}) interface{} {
+			return epochToTime(val, unit)
+		}}, true, nil
+	}
+	return columnConverter{}, false, fmt.Errorf("time column %s of type %s can not be parsed as time", name, typ)
+}
+
+// nanosecondsPerMonth is the length of a month of a duration, as months
+// vary in length.
+const nanosecondsPerMonth = 30 * 24 * int64(time.Hour)
+
+// durationNanoseconds returns the nanoseconds of a CQL duration, counting
+// months as 30 days.
+func durationNanoseconds(d gocql.Duration) int64 {
+	return int64(d.Months)*nanosecondsPerMonth + int64(d.Days)*24*int64(time.Hour) + d.Nanoseconds
+}
+
+// typeFieldConfig returns the field config of the fields of a column type:
+// time and duration columns are nanoseconds.
+func typeFieldConfig(typ string) *data.FieldConfig {
+	switch typ {
+	case "time", "duration":
+		return &data.FieldConfig{Unit: "ns"}
+	}
+	return nil
+}
+
+// timeFirst moves the time field to the front of the frame.
+func timeFirst(frame *data.Frame, name string) {
+	idx := fieldIndex(frame, name)
+	if idx <= 0 {
+		return
+	}
+	field := frame.Fields[idx]
+	copy(frame.Fields[1:idx+1], frame.Fields[:idx])
+	frame.Fields[0] = field
+}
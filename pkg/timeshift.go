@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timeShiftLabel is the label of the fields of a time shifted result.
+const timeShiftLabel = "timeShift"
+
+// dayShift matches a time shift in days or weeks, which time.ParseDuration does not support.
+var dayShift = regexp.MustCompile(`^([+-]?\d+)([dw])$`)
+
+// parseTimeShift parses a time shift, a duration (e.g. -1h30m) or a number
+// of days or weeks (e.g. -7d, -1w).
+func parseTimeShift(shift string) (time.Duration, error) {
+	if m := dayShift.FindStringSubmatch(shift); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		d := time.Duration(n) * 24 * time.Hour
+		if m[2] == "w" {
+			d *= 7
+		}
+		return d, nil
+	}
+	d, err := time.ParseDuration(shift)
+	if err != nil || d == 0 {
+		return 0, fmt.Errorf("invalid timeShift %q, use a duration such as -1h or -7d", shift)
+	}
+	return d, nil
+}
+
+// unshiftFrames moves the times of the frames of a time shifted query back
+// by shift, so they overlay the unshifted result, and labels the value
+// fields with the shift.
+func unshiftFrames(frames []*data.Frame, shift time.Duration, label string) {
+	for _, frame := range frames {
+		frame.Name += "_" + timeShiftLabel
+		for _, field := range frame.Fields {
+			if !isTimeField(field) {
+				if isValueField(field) {
+					labels := data.Labels{}
+					for k, v := range field.Labels {
+						labels[k] = v
+					}
+					labels[timeShiftLabel] = label
+					field.Labels = labels
+				}
+				continue
+			}
+			for i := 0; i < field.Len(); i++ {
+				if t, ok := timeAt(field, i); ok {
+					field.SetConcrete(i, t.Add(-shift))
+				}
+			}
+		}
+	}
+}
+
+// timeShiftQuery runs the query again on the time range shifted by shift and
+// adds its frames to the response, e.g. to compare a week with the previous one.
+func (td *SampleDatasource) timeShiftQuery(ctx context.Context, instance *instanceSettings, q backend.DataQuery, shift string, res *backend.DataResponse) error {
+	d, err := parseTimeShift(shift)
+	if err != nil {
+		return err
+	}
+	shifted := q
+	shifted.TimeRange = backend.TimeRange{From: q.TimeRange.From.Add(d), To: q.TimeRange.To.Add(d)}
+	sres := td.query(ctx, instance, shifted)
+	if sres.Error != nil {
+		return fmt.Errorf("time shifted query: %w", sres.Error)
+	}
+	unshiftFrames(sres.Frames, d, shift)
+	res.Frames = append(res.Frames, sres.Frames...)
+	return nil
+}
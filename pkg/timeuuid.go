@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timeUUIDSuffix is the suffix of the text fields keeping the UUID of the
+// timeuuid columns converted to time by the both timeuuidFormat.
+const timeUUIDSuffix = "_uuid"
+
+// checkTimeUUIDFormat validates the timeuuidFormat of a query: uuid, the
+// default, time or both, the time and the UUID.
+func checkTimeUUIDFormat(format string) error {
+	switch format {
+	case "", "uuid", "time", "both":
+		return nil
+	}
+	return fmt.Errorf("unknown timeuuidFormat %q, use uuid, time or both", format)
+}
+
+// convertsTimeUUIDs reports whether a timeuuidFormat returns timeuuid
+// columns as time fields.
+func convertsTimeUUIDs(format string) bool {
+	return format == "time" || format == "both"
+}
+
+// timeUUIDConverter returns the converter of a timeuuid column to its
+// embedded time for the time and both timeuuidFormat.
+func timeUUIDConverter(name string, info gocql.TypeInfo, format string) (columnConverter, bool) {
+	if info.Type() != gocql.TypeTimeUUID || !convertsTimeUUIDs(format) {
+		return columnConverter{}, false
+	}
+	cv, ok, _ := timeConverter(name, "timeuuid", "")
+	return cv, ok
+}
+
+// timeUUIDFields returns the time field of a timeuuid column followed by a
+// text field of its UUIDs, named column_uuid.
+func timeUUIDFields(field *data.Field, rows []interface{}) []*data.Field {
+	ids := make([]*string, len(rows))
+	for row, v := range rows {
+		if id, ok := v.(gocql.UUID); ok {
+			s := id.String()
+			ids[row] = &s
+		}
+	}
+	return []*data.Field{field, data.NewField(field.Name+timeUUIDSuffix, field.Labels, ids)}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryTimings is the execution breakdown of a query, reported in the frame
+// stats so users can tell a slow cluster from a saturated plugin.
+type queryTimings struct {
+	// queueWait is the time the query waited for an execution slot
+	queueWait time.Duration
+	connect   time.Duration
+	execute   time.Duration
+	convert   time.Duration
+}
+
+type queueWaitKey struct{}
+
+// withQueueWait records in the context how long a query waited before it started.
+func withQueueWait(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queueWaitKey{}, d)
+}
+
+func queueWaitFromContext(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(queueWaitKey{}).(time.Duration)
+	return d
+}
+
+// since adds the time elapsed since start to d and returns the current time.
+func since(d *time.Duration, start time.Time) time.Time {
+	now := time.Now()
+	*d += now.Sub(start)
+	return now
+}
+
+func durationStat(name string, d time.Duration) data.QueryStat {
+	return data.QueryStat{
+		FieldConfig: data.FieldConfig{DisplayName: name, Unit: "ms"},
+		Value:       float64(d) / float64(time.Millisecond),
+	}
+}
+
+// stats returns the timings as query stats, shown in the query inspector.
+func (t *queryTimings) stats() []data.QueryStat {
+	return []data.QueryStat{
+		durationStat("Queue wait", t.queueWait),
+		durationStat("Connect", t.connect),
+		durationStat("Execute", t.execute),
+		durationStat("Convert", t.convert),
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultCQLPort is the port of contact points configured without one.
+const defaultCQLPort = "9042"
+
+// certExpiryWarning is how long before the server certificate expires the
+// health check starts warning about it.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// buildTLSConfig returns the TLS configuration of the settings, nil when TLS
+// is disabled. The CA and client certificates are PEM encoded secure fields.
+func buildTLSConfig(settings editModel, secureData map[string]string) (*tls.Config, error) {
+	if !settings.TLS {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: settings.TLSSkipVerify}
+	if ca := secureData["tlsCACert"]; ca != "" {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.New("tlsCACert holds no valid PEM certificate")
+		}
+	}
+	cert, key := secureData["tlsClientCert"], secureData["tlsClientKey"]
+	if (cert == "") != (key == "") {
+		return nil, errors.New("both tlsClientCert and tlsClientKey must be set to use a client certificate")
+	}
+	if cert != "" {
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+// certificateExpiry is the validity of the certificate a host presents.
+type certificateExpiry struct {
+	Host            string    `json:"host"`
+	Subject         string    `json:"subject"`
+	NotAfter        time.Time `json:"notAfter"`
+	DaysUntilExpiry int       `json:"daysUntilExpiry"`
+	ExpiresSoon     bool      `json:"expiresSoon"`
+}
+
+// probeCertificate opens a TLS connection to a contact point and returns the
+// expiry of the certificate it presents.
+func (settings *instanceSettings) probeCertificate(host string) (*certificateExpiry, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, defaultCQLPort)
+	}
+	timeout := settings.options.connectTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", host, settings.tlsConfig.Clone())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("host " + host + " presented no certificate")
+	}
+	left := time.Until(certs[0].NotAfter)
+	return &certificateExpiry{
+		Host:            host,
+		Subject:         certs[0].Subject.String(),
+		NotAfter:        certs[0].NotAfter,
+		DaysUntilExpiry: int(left.Hours() / 24),
+		ExpiresSoon:     left < certExpiryWarning,
+	}, nil
+}
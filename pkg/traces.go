@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// traceQueryType is the query type reading a query trace of system_traces.
+const traceQueryType = "trace"
+
+// visTypeTrace is the preferred visualization of trace frames, it opens the
+// trace view in Explore.
+const visTypeTrace data.VisType = "trace"
+
+// traceKeyValue is a span tag of the trace view.
+type traceKeyValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// traceSession is a row of system_traces.sessions.
+type traceSession struct {
+	coordinator string
+	request     string
+	client      string
+	command     string
+	duration    int
+	startedAt   time.Time
+	parameters  map[string]string
+}
+
+// traceEvent is a row of system_traces.events.
+type traceEvent struct {
+	id       gocql.UUID
+	activity string
+	source   string
+	thread   string
+	elapsed  int
+}
+
+// traceSpan is a span of the trace frame, times are in milliseconds.
+type traceSpan struct {
+	spanID    string
+	parentID  string
+	operation string
+	service   string
+	start     float64
+	duration  float64
+	tags      []traceKeyValue
+}
+
+func tagsJSON(tags []traceKeyValue) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	body, _ := json.Marshal(tags)
+	return string(body)
+}
+
+const (
+	traceSessionQuery = "SELECT coordinator, request, client, command, duration, started_at, parameters FROM system_traces.sessions WHERE session_id = ?"
+	traceEventsQuery  = "SELECT event_id, activity, source, thread, source_elapsed FROM system_traces.events WHERE session_id = ?"
+)
+
+// readTrace reads the session and the events of a query trace. Both
+// statements go through the keyspace filter and the query rules of the
+// datasource like any other query.
+func (settings *instanceSettings) readTrace(ctx context.Context, sessionID gocql.UUID) (traceSession, []traceEvent, error) {
+	var s traceSession
+	for _, stmt := range []string{traceSessionQuery, traceEventsQuery} {
+		if err := settings.checkQuery(stmt); err != nil {
+			return s, nil, err
+		}
+	}
+	session, err := settings.getSession("")
+	if err != nil {
+		return s, nil, err
+	}
+	var coordinator, client net.IP
+	err = settings.newQuery(ctx, session, traceSessionQuery, sessionID).Scan(&coordinator, &s.request, &client, &s.command, &s.duration, &s.startedAt, &s.parameters)
+	if err == gocql.ErrNotFound {
+		return s, nil, fmt.Errorf("trace session %s not found, traces expire after 24 hours", sessionID)
+	}
+	if err != nil {
+		return s, nil, err
+	}
+	s.coordinator, s.client = coordinator.String(), client.String()
+	var events []traceEvent
+	var e traceEvent
+	var source net.IP
+	iter := settings.newQuery(ctx, session, traceEventsQuery, sessionID).Iter()
+	for iter.Scan(&e.id, &e.activity, &source, &e.thread, &e.elapsed) {
+		e.source = source.String()
+		events = append(events, e)
+	}
+	if err := iter.Close(); err != nil {
+		return s, nil, err
+	}
+	return s, events, nil
+}
+
+// traceSpans returns the spans of a trace: the session is the root span and
+// each event a child span, lasting until the next event of the same node
+// and thread or the end of the session.
+func traceSpans(sessionID string, s traceSession, events []traceEvent) []traceSpan {
+	start := float64(s.startedAt.UnixNano()) / float64(time.Millisecond)
+	root := traceSpan{
+		spanID:    sessionID,
+		operation: s.request,
+		service:   s.coordinator,
+		start:     start,
+		duration:  float64(s.duration) / 1000,
+		tags: []traceKeyValue{
+			{Key: "client", Value: s.client},
+			{Key: "command", Value: s.command},
+		},
+	}
+	names := make([]string, 0, len(s.parameters))
+	for name := range s.parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		root.tags = append(root.tags, traceKeyValue{Key: name, Value: s.parameters[name]})
+	}
+	spans := []traceSpan{root}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].id.Time().Before(events[j].id.Time())
+	})
+	last := make(map[string]int)
+	for _, e := range events {
+		key := e.source + "/" + e.thread
+		if i, ok := last[key]; ok {
+			spans[i].duration = float64(e.id.Time().UnixNano())/float64(time.Millisecond) - spans[i].start
+		}
+		last[key] = len(spans)
+		spans = append(spans, traceSpan{
+			spanID:    e.id.String(),
+			parentID:  sessionID,
+			operation: e.activity,
+			service:   e.source,
+			start:     float64(e.id.Time().UnixNano()) / float64(time.Millisecond),
+			tags: []traceKeyValue{
+				{Key: "thread", Value: e.thread},
+				{Key: "source_elapsed_us", Value: e.elapsed},
+			},
+		})
+	}
+	// the last event of each thread lasts until the end of the session
+	end := root.start + root.duration
+	for _, i := range last {
+		if end > spans[i].start {
+			spans[i].duration = end - spans[i].start
+		}
+	}
+	return spans
+}
+
+// traceFrame returns the spans in the trace frame format of Grafana.
+func traceFrame(traceID string, spans []traceSpan) *data.Frame {
+	frame := data.NewFrame("trace",
+		data.NewField("traceID", nil, []string{}),
+		data.NewField("spanID", nil, []string{}),
+		data.NewField("parentSpanID", nil, []string{}),
+		data.NewField("operationName", nil, []string{}),
+		data.NewField("serviceName", nil, []string{}),
+		data.NewField("serviceTags", nil, []string{}),
+		data.NewField("startTime", nil, []float64{}),
+		data.NewField("duration", nil, []float64{}),
+		data.NewField("logs", nil, []string{}),
+		data.NewField("tags", nil, []string{}),
+	)
+	for _, s := range spans {
+		serviceTags := tagsJSON([]traceKeyValue{{Key: "host", Value: s.service}})
+		frame.AppendRow(traceID, s.spanID, s.parentID, s.operation, s.service, serviceTags, s.start, s.duration, "[]", tagsJSON(s.tags))
+	}
+	frame.Meta = &data.FrameMeta{PreferredVisualization: visTypeTrace}
+	return frame
+}
+
+// traceResponse runs a trace query, reading the trace of qm.SessionID.
+func (settings *instanceSettings) traceResponse(ctx context.Context, qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+	if qm.SessionID == "" {
+		response.Error = errors.New("a trace query requires a sessionId")
+		return response
+	}
+	sessionID, err := gocql.ParseUUID(qm.SessionID)
+	if err != nil {
+		response.Error = fmt.Errorf("invalid sessionId %q: %w", qm.SessionID, err)
+		return response
+	}
+	s, events, err := settings.readTrace(ctx, sessionID)
+	if err != nil {
+		log.DefaultLogger.Info("Failed reading trace", "err", err)
+		response.Error = withHint(err)
+		return response
+	}
+	response.Frames = append(response.Frames, traceFrame(sessionID.String(), traceSpans(sessionID.String(), s, events)))
+	return response
+}
+
+// traceFetchAttempts bounds how many times a trace is read while its events
+// are still being written.
+const traceFetchAttempts = 5
+
+// traceCollector collects the trace session ids of a traced query, one per
+// page fetched.
+type traceCollector struct {
+	mu  sync.Mutex
+	ids []gocql.UUID
+}
+
+func (c *traceCollector) Trace(traceID []byte) {
+	id, err := gocql.UUIDFromBytes(traceID)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.ids = append(c.ids, id)
+	c.mu.Unlock()
+}
+
+// queryTrace is the trace of a query attached to the frame metadata,
+// durations are in microseconds.
+type queryTrace struct {
+	SessionID   string            `json:"sessionId"`
+	Coordinator string            `json:"coordinator"`
+	Duration    int               `json:"durationUs"`
+	Events      []queryTraceEvent `json:"events"`
+}
+
+type queryTraceEvent struct {
+	Activity string `json:"activity"`
+	Source   string `json:"source"`
+	Thread   string `json:"thread"`
+	Elapsed  int    `json:"elapsedUs"`
+}
+
+// fetchTraces reads the traces of a query. Scylla writes traces in the
+// background, a session without a duration is still being written and is
+// read again shortly after.
+func (settings *instanceSettings) fetchTraces(ctx context.Context, ids []gocql.UUID) []queryTrace {
+	var res []queryTrace
+	for _, id := range ids {
+		var s traceSession
+		var events []traceEvent
+		var err error
+		for attempt := 1; attempt <= traceFetchAttempts; attempt++ {
+			s, events, err = settings.readTrace(ctx, id)
+			if err == nil && s.duration > 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return res
+			case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+			}
+		}
+		if err != nil {
+			log.DefaultLogger.Info("Failed reading query trace", "session", id, "err", err)
+			continue
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].id.Time().Before(events[j].id.Time())
+		})
+		t := queryTrace{SessionID: id.String(), Coordinator: s.coordinator, Duration: s.duration, Events: []queryTraceEvent{}}
+		for _, e := range events {
+			t.Events = append(t.Events, queryTraceEvent{Activity: e.activity, Source: e.source, Thread: e.thread, Elapsed: e.elapsed})
+		}
+		res = append(res, t)
+	}
+	return res
+}
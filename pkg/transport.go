@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultCQLTLSPort is the port Scylla conventionally serves CQL over TLS on.
+const defaultCQLTLSPort = "9142"
+
+// transportProbeTimeout bounds each connection of a transport probe.
+const transportProbeTimeout = 2 * time.Second
+
+// cqlOptionsFrame is a protocol v4 OPTIONS request, any CQL server answers
+// it with a response frame, even one of another protocol version.
+var cqlOptionsFrame = []byte{0x04, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00}
+
+// transportProbe is what a host port speaks.
+type transportProbe struct {
+	Address   string `json:"address"`
+	TLS       bool   `json:"tls"`
+	Plaintext bool   `json:"plaintext"`
+}
+
+// speaksCQL sends an OPTIONS request over an open connection and reports
+// whether a CQL response frame came back.
+func speaksCQL(conn net.Conn) bool {
+	conn.SetDeadline(time.Now().Add(transportProbeTimeout))
+	if _, err := conn.Write(cqlOptionsFrame); err != nil {
+		return false
+	}
+	header := make([]byte, len(cqlOptionsFrame))
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return false
+	}
+	// the direction bit is set in responses
+	return header[0]&0x80 != 0 && header[4] != 0x05
+}
+
+// probeTransport reports whether an address speaks CQL over TLS, plaintext or neither.
+func probeTransport(address string) transportProbe {
+	res := transportProbe{Address: address}
+	dialer := &net.Dialer{Timeout: transportProbeTimeout}
+	if conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true}); err == nil {
+		res.TLS = speaksCQL(conn)
+		conn.Close()
+	}
+	if !res.TLS {
+		if conn, err := dialer.Dial("tcp", address); err == nil {
+			res.Plaintext = speaksCQL(conn)
+			conn.Close()
+		}
+	}
+	return res
+}
+
+// transportHint probes what the first contact point speaks on its port and
+// on another conventional CQL port and returns the connection
+// error with actionable guidance, instead of the EOF or timeout errors the
+// driver reports when the transport does not match.
+func (settings *instanceSettings) transportHint(err error) error {
+	if err == nil || !settings.settings.ProbeTransport {
+		return err
+	}
+	hosts := splitList(settings.settings.Host)
+	if len(hosts) == 0 {
+		return err
+	}
+	host, port, splitErr := net.SplitHostPort(hosts[0])
+	if splitErr != nil {
+		host, port = hosts[0], defaultCQLPort
+	}
+	useTLS := settings.tlsConfig != nil
+	configured := probeTransport(net.JoinHostPort(host, port))
+	// the conventional port of the configured transport, or of the other one
+	other := defaultCQLPort
+	if useTLS {
+		other = defaultCQLTLSPort
+	}
+	if other == port {
+		other = map[string]string{defaultCQLPort: defaultCQLTLSPort, defaultCQLTLSPort: defaultCQLPort}[port]
+	}
+	alternate := probeTransport(net.JoinHostPort(host, other))
+	var hint []string
+	switch {
+	case useTLS && configured.Plaintext:
+		hint = append(hint, fmt.Sprintf("%s speaks plaintext CQL, not TLS; disable tls", configured.Address))
+	case !useTLS && configured.TLS:
+		hint = append(hint, fmt.Sprintf("%s expects TLS; enable tls in the datasource settings", configured.Address))
+	case !configured.TLS && !configured.Plaintext:
+		hint = append(hint, fmt.Sprintf("nothing answers CQL on %s", configured.Address))
+	default:
+		return err
+	}
+	if useTLS && alternate.TLS || !useTLS && alternate.Plaintext {
+		hint = append(hint, fmt.Sprintf("or connect to port %s", other))
+	} else if alternate.TLS {
+		hint = append(hint, fmt.Sprintf("(port %s speaks TLS)", other))
+	} else if alternate.Plaintext {
+		hint = append(hint, fmt.Sprintf("(port %s speaks plaintext CQL)", other))
+	}
+	return fmt.Errorf("%w: %s", err, strings.Join(hint, " "))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// tupleFields returns a field per element of the tuple values of a column,
+// named column[index] and typed as the element.
+func tupleFields(name string, info gocql.TupleTypeInfo, rows []interface{}) []*data.Field {
+	fields := make([]*data.Field, len(info.Elems))
+	for k, elem := range info.Elems {
+		typ := elem.Type().String()
+		field := data.NewField(fmt.Sprintf("%s[%d]", name, k), nil, getTypeArray(typ))
+		field.Extend(len(rows))
+		text := isTextType(typ)
+		for row, v := range rows {
+			elems, ok := v.([]interface{})
+			if !ok || k >= len(elems) {
+				continue
+			}
+			if value := fieldValue(elems[k], typ, text); value != nil {
+				field.SetConcrete(row, value)
+			}
+		}
+		fields[k] = field
+	}
+	return fields
+}
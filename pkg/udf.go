@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// userFunction is a user defined function or aggregate of system_schema.
+type userFunction struct {
+	Keyspace   string
+	Name       string
+	Kind       string
+	Arguments  []string
+	ReturnType string
+}
+
+// signature returns the CQL signature of the function, e.g. ks.fn(int, text).
+func (f userFunction) signature() string {
+	return quoteIdentifier(f.Keyspace) + "." + quoteIdentifier(f.Name) + "(" + strings.Join(f.Arguments, ", ") + ")"
+}
+
+// schemaFunctions returns the user defined functions and aggregates of a
+// keyspace, one per overload.
+func (settings *instanceSettings) schemaFunctions(keyspace string) ([]userFunction, error) {
+	if err := settings.keyspaces.checkKeyspace(`"` + keyspace + `"`); err != nil {
+		return nil, err
+	}
+	v, err := settings.schema.get("functions/"+keyspace, func() (interface{}, error) {
+		session, err := settings.getSession("")
+		if err != nil {
+			return nil, err
+		}
+		var res []userFunction
+		for _, kind := range []string{"function", "aggregate"} {
+			f := userFunction{Keyspace: keyspace, Kind: "scalar"}
+			if kind == "aggregate" {
+				f.Kind = "aggregate"
+			}
+			iter := session.Query("SELECT "+kind+"_name, argument_types, return_type FROM system_schema."+kind+"s WHERE keyspace_name = ?",
+				keyspace).Iter()
+			for iter.Scan(&f.Name, &f.Arguments, &f.ReturnType) {
+				res = append(res, f)
+				f.Arguments = nil
+			}
+			if err := iter.Close(); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].Name < res[j].Name
+		})
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]userFunction), nil
+}
+
+func (settings *instanceSettings) functionOverloads(keyspace string, name string) []userFunction {
+	functions, _ := settings.schemaFunctions(keyspace)
+	known := make([]string, len(functions))
+	for i, f := range functions {
+		known[i] = f.Name
+	}
+	name = matchName(name, known)
+	var res []userFunction
+	for _, f := range functions {
+		if f.Name == name {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func (settings *instanceSettings) columnType(keyspace string, table string, name string) string {
+	columns, _ := settings.schemaColumns(keyspace, table)
+	for _, c := range columns {
+		if c.Name == name {
+			return c.Type
+		}
+	}
+	return ""
+}
+
+// builderFunction is a user defined function or aggregate selected in
+// builder mode. Function is the function name, qualified by its keyspace
+// unless it is defined in the keyspace of the table, and Args are the
+// columns it is applied to.
+type builderFunction struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+	Alias    string   `json:"alias"`
+	expr     string
+}
+
+// sameType reports whether two CQL type names are the same type.
+func sameType(a string, b string) bool {
+	return strings.EqualFold(strings.Replace(a, " ", "", -1), strings.Replace(b, " ", "", -1))
+}
+
+// resolve finds the overload of a builder function matching the types
+// of its argument columns and sets the expression it is selected with.
+func (f *builderFunction) resolve(names nameResolver, keyspace string, table string) error {
+	fnKeyspace, fnName := keyspace, f.Function
+	if parts := strings.SplitN(f.Function, ".", 2); len(parts) == 2 && !isQuoted(f.Function) {
+		if err := checkIdentifier("keyspace", parts[0]); err != nil {
+			return err
+		}
+		fnKeyspace, fnName = names.resolveKeyspace(parts[0]), parts[1]
+	}
+	if err := checkIdentifier("function", fnName); err != nil {
+		return err
+	}
+	overloads := names.functionOverloads(fnKeyspace, fnName)
+	if len(overloads) == 0 {
+		return fmt.Errorf("unknown function %s in keyspace %s", fnName, fnKeyspace)
+	}
+	args := make([]string, len(f.Args))
+	types := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		if err := checkIdentifier("function argument", a); err != nil {
+			return err
+		}
+		column := names.resolveColumn(keyspace, table, a)
+		args[i], types[i] = quoteIdentifier(column), names.columnType(keyspace, table, column)
+		if types[i] == "" {
+			return fmt.Errorf("unknown column %s in the arguments of %s", a, fnName)
+		}
+	}
+	var match *userFunction
+	for i, o := range overloads {
+		if len(o.Arguments) != len(types) {
+			continue
+		}
+		ok := true
+		for j, t := range o.Arguments {
+			if !sameType(t, types[j]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			match = &overloads[i]
+			break
+		}
+	}
+	if match == nil {
+		signatures := make([]string, len(overloads))
+		for i, o := range overloads {
+			signatures[i] = o.signature()
+		}
+		return fmt.Errorf("function %s does not take arguments (%s), it is defined as %s",
+			fnName, strings.Join(types, ", "), strings.Join(signatures, ", "))
+	}
+	// by default the result is named like the function as stored in the
+	// schema, a mixed case function is not aliased to its lower case name
+	alias := match.Name
+	if f.Alias != "" {
+		if err := checkIdentifier("alias", f.Alias); err != nil {
+			return err
+		}
+		alias = matchName(f.Alias, nil)
+	}
+	f.expr = fmt.Sprintf("%s.%s(%s) AS %s", quoteIdentifier(match.Keyspace), quoteIdentifier(match.Name),
+		strings.Join(args, ", "), quoteIdentifier(alias))
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// udtMember is a member of a user defined type column, nested types are
+// flattened into their members.
+type udtMember struct {
+	path []string
+	typ  string
+}
+
+// udtMembers returns the members of a user defined type, the members of
+// nested types in place of the nested type.
+func udtMembers(info gocql.UDTTypeInfo, path []string) []udtMember {
+	var res []udtMember
+	for _, e := range info.Elements {
+		p := append(append([]string{}, path...), e.Name)
+		if nested, ok := e.Type.(gocql.UDTTypeInfo); ok {
+			res = append(res, udtMembers(nested, p)...)
+			continue
+		}
+		res = append(res, udtMember{path: p, typ: e.Type.Type().String()})
+	}
+	return res
+}
+
+// udtValue returns the value of a member of a scanned user defined type.
+func udtValue(v interface{}, path []string) interface{} {
+	for _, name := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// udtFields returns a field per member of the user defined type values of a
+// column, named column.member (column.member.member for nested types) and
+// typed as the member.
+func udtFields(name string, info gocql.UDTTypeInfo, rows []interface{}) []*data.Field {
+	members := udtMembers(info, nil)
+	fields := make([]*data.Field, len(members))
+	for k, m := range members {
+		fieldName := name
+		for _, p := range m.path {
+			fieldName += "." + p
+		}
+		field := data.NewField(fieldName, nil, getTypeArray(m.typ))
+		field.Extend(len(rows))
+		text := isTextType(m.typ)
+		for row, v := range rows {
+			if value := fieldValue(udtValue(v, m.path), m.typ, text); value != nil {
+				field.SetConcrete(row, value)
+			}
+		}
+		fields[k] = field
+	}
+	return fields
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// settingsErrors lists all the problems found in the datasource settings.
+type settingsErrors []string
+
+func (e settingsErrors) Error() string {
+	return "invalid datasource settings: " + strings.Join(e, "; ")
+}
+
+// validateHost checks a host[:port] contact point.
+func validateHost(host string) string {
+	if strings.ContainsAny(host, " /") {
+		return "host " + strconv.Quote(host) + " is not a valid address, use host or host:port"
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if h == "" {
+			return "host " + strconv.Quote(host) + " has no address"
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return "host " + strconv.Quote(host) + " has an invalid port"
+		}
+	}
+	return ""
+}
+
+// validateSettings checks the datasource settings and returns all the
+// problems found, so a provisioned datasource reports every invalid setting
+// at once instead of failing on the first query.
+func validateSettings(settings editModel, secureData map[string]string) error {
+	var errs settingsErrors
+	for _, host := range splitList(settings.Host) {
+		if msg := validateHost(host); msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+	_, hasUser := secureData["user"]
+	_, hasPassword := secureData["password"]
+	if hasUser != hasPassword {
+		errs = append(errs, "both user and password must be set to use authentication")
+	}
+	_, hasMonitorUser := secureData["monitorUser"]
+	_, hasMonitorPassword := secureData["monitorPassword"]
+	if hasMonitorUser != hasMonitorPassword {
+		errs = append(errs, "both monitorUser and monitorPassword must be set to use a health check credential")
+	}
+	if _, err := parseClusterOptions(settings); err != nil {
+		if clusterErrs, ok := err.(settingsErrors); ok {
+			errs = append(errs, clusterErrs...)
+		} else {
+			errs = append(errs, err.Error())
+		}
+	}
+	if _, err := parseDuration("schemaCacheTTL", settings.SchemaCacheTTL, defaultSchemaCacheTTL); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := compileRewriteRules(settings.RewriteRules); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := newQueryRules(settings); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := parseDuration("resultCacheTTL", settings.ResultCacheTTL, 0); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.DashboardQueryRate < 0 {
+		errs = append(errs, "invalid dashboardQueryRate "+strconv.FormatFloat(settings.DashboardQueryRate, 'g', -1, 64))
+	}
+	if settings.DashboardQueryBurst < 0 {
+		errs = append(errs, "invalid dashboardQueryBurst "+strconv.Itoa(settings.DashboardQueryBurst))
+	}
+	if settings.ResultCacheSize < 0 {
+		errs = append(errs, "invalid resultCacheSize "+strconv.Itoa(settings.ResultCacheSize))
+	}
+	if err := checkEmptyResultMode(settings.EmptyResult); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := checkDecimalFormat(settings.DecimalFormat); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := checkQueryLogLevel(settings.QueryLogLevel); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := compileQueryTemplates(settings.QueryTemplates); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := checkMonitoringLinks(settings.MonitoringLinks); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := checkAnnotationsSettings(settings); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := buildTLSConfig(settings, secureData); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if settings.CacheDir != "" {
+		if info, err := os.Stat(settings.CacheDir); err != nil || !info.IsDir() {
+			errs = append(errs, "cacheDir "+strconv.Quote(settings.CacheDir)+" is not a directory")
+		}
+	}
+	denied := toKeyspaceSet(settings.DeniedKeyspaces)
+	for ks := range toKeyspaceSet(settings.AllowedKeyspaces) {
+		if denied[ks] {
+			errs = append(errs, "keyspace "+ks+" is both allowed and denied")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// settingsValidation is the response of /validate-settings.
+type settingsValidation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// handleValidateSettings validates the JSONData posted in the request body,
+// so settings can be checked before they are saved or provisioned. It is
+// only available to admins, cacheDir is checked on the Grafana host.
+func (td *SampleDatasource) handleValidateSettings(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeError(w, http.StatusForbidden, errors.New("settings validation is only available to admins"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST with the datasource JSONData as the body"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var settings editModel
+	if err := json.Unmarshal(body, &settings); err != nil {
+		writeJSON(w, http.StatusOK, settingsValidation{Errors: []string{"invalid JSON: " + err.Error()}})
+		return
+	}
+	// credentials are validated by the instance, they are never posted here
+	err = validateSettings(settings, map[string]string{})
+	if errs, ok := err.(settingsErrors); ok {
+		writeJSON(w, http.StatusOK, settingsValidation{Errors: errs})
+		return
+	}
+	writeJSON(w, http.StatusOK, settingsValidation{Valid: true})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// variableQueryTypes are the query types populating template variables,
+// they return a single field frame of values.
+var variableQueryTypes = map[string]bool{
+	"keyspaces": true,
+	"tables":    true,
+	"columns":   true,
+	"query":     true,
+}
+
+func isVariableQueryType(queryType string) bool {
+	return variableQueryTypes[queryType]
+}
+
+// schemaVariableValues returns the values of a keyspaces, tables or columns
+// variable query, read from the schema cache.
+func (settings *instanceSettings) schemaVariableValues(qm queryModel) ([]string, error) {
+	switch qm.QueryType {
+	case "keyspaces":
+		return settings.schemaKeyspaces()
+	case "tables":
+		if qm.Keyspace == "" {
+			return nil, errors.New("a tables variable query requires a keyspace")
+		}
+		return settings.schemaTables(settings.resolveKeyspace(qm.Keyspace))
+	case "columns":
+		if qm.Keyspace == "" || qm.Table == "" {
+			return nil, errors.New("a columns variable query requires a keyspace and a table")
+		}
+		keyspace := settings.resolveKeyspace(qm.Keyspace)
+		columns, err := settings.schemaColumns(keyspace, settings.resolveTable(keyspace, qm.Table))
+		if err != nil {
+			return nil, err
+		}
+		res := make([]string, len(columns))
+		for i, c := range columns {
+			res[i] = c.Name
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported variable query type %q", qm.QueryType)
+}
+
+// variableFrame returns a frame holding the values of a variable query.
+func variableFrame(values []string) *data.Frame {
+	if values == nil {
+		values = []string{}
+	}
+	return data.NewFrame("values", data.NewField("value", nil, values))
+}
+
+// variableValues returns the values of the first field of a query result,
+// so a custom CQL variable query may select any column type.
+func variableValues(frame *data.Frame) []string {
+	if len(frame.Fields) == 0 {
+		return nil
+	}
+	f := frame.Fields[0]
+	res := make([]string, 0, f.Len())
+	for i := 0; i < f.Len(); i++ {
+		if v, ok := f.ConcreteAt(i); ok {
+			res = append(res, fmt.Sprintf("%v", v))
+		}
+	}
+	return res
+}
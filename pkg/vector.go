@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// vectorTypePrefix is the class of vector columns, which the driver reports
+// as custom types, e.g. VectorType(org.apache.cassandra.db.marshal.FloatType, 3).
+const vectorTypePrefix = "org.apache.cassandra.db.marshal.VectorType("
+
+// vectorElemSizes are the sizes of the element types of the supported
+// vectors, serialized one after the other without length.
+var vectorElemSizes = map[string]int{"FloatType": 4, "DoubleType": 8, "Int32Type": 4, "LongType": 8}
+
+// vectorType is the element type and the dimension of a vector column.
+type vectorType struct {
+	elem string
+	dim  int
+}
+
+// parseVectorType returns the vector type of a column, false when the
+// column is not a vector of a supported element type.
+func parseVectorType(info gocql.TypeInfo) (vectorType, bool) {
+	if info.Type() != gocql.TypeCustom || !strings.HasPrefix(info.Custom(), vectorTypePrefix) {
+		return vectorType{}, false
+	}
+	args := strings.TrimSuffix(strings.TrimPrefix(info.Custom(), vectorTypePrefix), ")")
+	sep := strings.LastIndex(args, ",")
+	if sep < 0 {
+		return vectorType{}, false
+	}
+	elem := strings.TrimPrefix(strings.TrimSpace(args[:sep]), "org.apache.cassandra.db.marshal.")
+	dim, err := strconv.Atoi(strings.TrimSpace(args[sep+1:]))
+	if _, ok := vectorElemSizes[elem]; !ok || err != nil || dim <= 0 {
+		return vectorType{}, false
+	}
+	return vectorType{elem: elem, dim: dim}, true
+}
+
+// decode returns the elements of a serialized vector.
+func (t vectorType) decode(b []byte) ([]float64, error) {
+	size := vectorElemSizes[t.elem]
+	if len(b) != size*t.dim {
+		return nil, fmt.Errorf("vector of %d bytes, expected %d %s elements", len(b), t.dim, t.elem)
+	}
+	res := make([]float64, t.dim)
+	for i := range res {
+		e := b[i*size : (i+1)*size]
+		switch t.elem {
+		case "FloatType":
+			res[i] = float64(math.Float32frombits(binary.BigEndian.Uint32(e)))
+		case "DoubleType":
+			res[i] = math.Float64frombits(binary.BigEndian.Uint64(e))
+		case "Int32Type":
+			res[i] = float64(int32(binary.BigEndian.Uint32(e)))
+		case "LongType":
+			res[i] = float64(int64(binary.BigEndian.Uint64(e)))
+		}
+	}
+	return res, nil
+}
+
+// customValue holds the bytes of a column of a custom type, e.g. a vector,
+// which the driver can not unmarshal.
+type customValue []byte
+
+// UnmarshalCQL implements gocql.Unmarshaler.
+func (v *customValue) UnmarshalCQL(info gocql.TypeInfo, data []byte) error {
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+// customConverter returns the converter of a column of a custom type: the
+// JSON array of the elements of vectors, the bytes in hex of other types.
+func customConverter(info gocql.TypeInfo) (columnConverter, bool) {
+	if info.Type() != gocql.TypeCustom {
+		return columnConverter{}, false
+	}
+	vector, isVector := parseVectorType(info)
+	return columnConverter{typ: "text", convert: func(val interface{}) interface{} {
+		b, ok := val.(customValue)
+		if !ok {
+			return nil
+		}
+		if isVector {
+			if elems, err := vector.decode(b); err == nil {
+				text, _ := json.Marshal(elems)
+				return string(text)
+			}
+		}
+		return "0x" + hex.EncodeToString(b)
+	}}, true
+}
+
+// vectorFields returns a float64 field per element of the vector values of
+// a column, named column[index].
+func vectorFields(name string, vector vectorType, rows []interface{}) []*data.Field {
+	fields := make([]*data.Field, vector.dim)
+	for k := range fields {
+		fields[k] = data.NewField(fmt.Sprintf("%s[%d]", name, k), nil, make([]*float64, len(rows)))
+	}
+	for row, v := range rows {
+		b, ok := v.(customValue)
+		if !ok {
+			continue
+		}
+		elems, err := vector.decode(b)
+		if err != nil {
+			continue
+		}
+		for k := range elems {
+			fields[k].Set(row, &elems[k])
+		}
+	}
+	return fields
+}
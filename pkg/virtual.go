@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// virtualTable is a table that may hold a curated system view.
+type virtualTable struct {
+	keyspace string
+	table    string
+	// virtual is true for tables listed in system_virtual_schema (Cassandra 4)
+	// instead of system_schema.
+	virtual bool
+}
+
+// virtualQueryTypes maps the curated ops query types to the tables that
+// may provide them, in order of preference. Scylla and Cassandra expose
+// the same information in different tables and versions.
+var virtualQueryTypes = map[string][]virtualTable{
+	"clients": {
+		{keyspace: "system", table: "clients"},
+		{keyspace: "system_views", table: "clients", virtual: true},
+	},
+	"caches": {
+		{keyspace: "system_views", table: "caches", virtual: true},
+	},
+	"protocol_servers": {
+		{keyspace: "system", table: "protocol_servers"},
+	},
+}
+
+func isVirtualQueryType(queryType string) bool {
+	_, ok := virtualQueryTypes[queryType]
+	return ok
+}
+
+// tableExists reports whether a table exists. Failing to read a missing
+// system_virtual_schema is treated as the table not existing.
+func (settings *instanceSettings) tableExists(t virtualTable) (bool, error) {
+	schemaKeyspace := "system_schema"
+	if t.virtual {
+		schemaKeyspace = "system_virtual_schema"
+	}
+	v, err := settings.schema.get("exists/"+schemaKeyspace+"/"+t.keyspace+"/"+t.table, func() (interface{}, error) {
+		names, err := settings.schemaStrings("SELECT table_name FROM "+schemaKeyspace+".tables WHERE keyspace_name = ? AND table_name = ?",
+			t.keyspace, t.table)
+		if err != nil && t.virtual {
+			return false, nil
+		}
+		return len(names) > 0, err
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// virtualTableFor returns the table providing a curated query type on the
+// connected cluster.
+func (settings *instanceSettings) virtualTableFor(queryType string) (virtualTable, error) {
+	for _, t := range virtualQueryTypes[queryType] {
+		exists, err := settings.tableExists(t)
+		if err != nil {
+			return t, err
+		}
+		if exists {
+			return t, nil
+		}
+	}
+	return virtualTable{}, fmt.Errorf("the cluster does not provide %s information", queryType)
+}
+
+// virtualQuery returns the CQL statement of a curated query type.
+func (settings *instanceSettings) virtualQuery(queryType string) (string, error) {
+	t, err := settings.virtualTableFor(queryType)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("SELECT * FROM %s.%s", t.keyspace, t.table), nil
+}
+
+// handleVirtualTables lists the curated query types the cluster supports.
+func (td *SampleDatasource) handleVirtualTables(w http.ResponseWriter, r *http.Request) {
+	instance, err := td.getInstance(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var available []string
+	for queryType := range virtualQueryTypes {
+		if _, err := instance.virtualTableFor(queryType); err == nil {
+			available = append(available, queryType)
+		}
+	}
+	sort.Strings(available)
+	writeJSON(w, http.StatusOK, nonNil(available))
+}
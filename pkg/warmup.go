@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// maxWarmEntries bounds the queries and the tables kept in a warm set.
+const maxWarmEntries = 50
+
+// warmSet is the set of recently used tables and statements of an instance,
+// persisted in the cacheDir setting so the caches are warmed up again after
+// Grafana restarts.
+type warmSet struct {
+	mu   sync.Mutex
+	path string
+	// Queries are statements with bind markers, their text is stable between
+	// refreshes so preparing them again is worth it.
+	Queries []string `json:"queries"`
+	// Tables are the keyspace qualified tables whose schema is loaded.
+	Tables []string `json:"tables"`
+}
+
+// warmSetPath returns the file holding the warm set of a datasource.
+func warmSetPath(dir string, id int64) string {
+	return filepath.Join(dir, fmt.Sprintf("scylla-warm-%d.json", id))
+}
+
+// loadWarmSet reads a persisted warm set, a missing or broken file starts an empty one.
+func loadWarmSet(path string) *warmSet {
+	w := &warmSet{path: path}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.DefaultLogger.Warn("Failed reading the warm set", "path", path, "err", err)
+		}
+		return w
+	}
+	if err := json.Unmarshal(body, w); err != nil {
+		log.DefaultLogger.Warn("Ignoring a broken warm set", "path", path, "err", err)
+	}
+	return w
+}
+
+// addEntry adds value to list unless it is already there, dropping the
+// oldest entry when the list is full.
+func addEntry(list []string, value string) ([]string, bool) {
+	for _, v := range list {
+		if v == value {
+			return list, false
+		}
+	}
+	list = append(list, value)
+	if len(list) > maxWarmEntries {
+		list = list[len(list)-maxWarmEntries:]
+	}
+	return list, true
+}
+
+// record adds the tables of an executed query, and the query itself when it
+// has bind markers, to the warm set. The file is only written when a new
+// entry was added.
+func (w *warmSet) record(query string, bound bool) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := false
+	refs, _ := queryTableRefs(query)
+	for _, ref := range refs {
+		if ref.keyspace != "" && ref.table != "" {
+			var added bool
+			w.Tables, added = addEntry(w.Tables, ref.keyspace+"."+ref.table)
+			changed = changed || added
+		}
+	}
+	if bound {
+		var added bool
+		w.Queries, added = addEntry(w.Queries, query)
+		changed = changed || added
+	}
+	if changed {
+		w.save()
+	}
+}
+
+// save writes the warm set atomically, the caller holds mu.
+func (w *warmSet) save() {
+	body, err := json.Marshal(w)
+	if err != nil {
+		log.DefaultLogger.Warn("Failed encoding the warm set", "err", err)
+		return
+	}
+	tmp := w.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+		log.DefaultLogger.Warn("Failed writing the warm set", "path", tmp, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		log.DefaultLogger.Warn("Failed writing the warm set", "path", w.path, "err", err)
+	}
+}
+
+func (w *warmSet) entries() ([]string, []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.Tables...), append([]string(nil), w.Queries...)
+}
+
+// warmUp connects to the cluster, loads the schema of the recently used
+// tables and prepares the recently used statements, so the first dashboards
+// after a restart do not pay the cold start latency.
+func (settings *instanceSettings) warmUp() {
+	if settings.warm == nil {
+		return
+	}
+	start := time.Now()
+	tables, queries := settings.warm.entries()
+	session, err := settings.getSession("")
+	if err != nil {
+		log.DefaultLogger.Info("Skipping the cache warm up", "err", err)
+		return
+	}
+	if _, err := settings.schemaKeyspaces(); err != nil {
+		log.DefaultLogger.Debug("Failed warming up the keyspaces", "err", err)
+	}
+	for _, table := range tables {
+		parts := strings.SplitN(table, ".", 2)
+		if _, err := settings.schemaColumns(parts[0], parts[1]); err != nil {
+			log.DefaultLogger.Debug("Failed warming up a table", "table", table, "err", err)
+		}
+	}
+	for _, query := range queries {
+		if err := prepareStatement(session.Query(query)); err != nil {
+			log.DefaultLogger.Debug("Failed preparing a recent query", "query", query, "err", err)
+		}
+	}
+	log.DefaultLogger.Info("Warmed up the caches", "tables", len(tables), "queries", len(queries), "duration", time.Since(start))
+}
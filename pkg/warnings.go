@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// tombstoneWarning matches the server warning sent when a read scans many tombstones, e.g.
+// "Read 10 live rows and 5000 tombstone cells for query SELECT ...".
+var tombstoneWarning = regexp.MustCompile(`(?i)read (\d+) live rows? and (\d+) tombstone`)
+
+// warningNotices converts the warnings the server attached to a query
+// response into frame notices. Tombstone warnings are summarized with the
+// total number of live rows and tombstones read.
+func warningNotices(warnings []string) []data.Notice {
+	var notices []data.Notice
+	var live, tombstones int64
+	tombstoneReads := 0
+	for _, w := range warnings {
+		if m := tombstoneWarning.FindStringSubmatch(w); m != nil {
+			l, _ := strconv.ParseInt(m[1], 10, 64)
+			t, _ := strconv.ParseInt(m[2], 10, 64)
+			live += l
+			tombstones += t
+			tombstoneReads++
+			continue
+		}
+		notices = append(notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "Server warning: " + w})
+	}
+	if tombstoneReads > 0 {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text: fmt.Sprintf("The query read %d tombstones and only %d live rows, tombstone heavy reads are slow and degrade the cluster."+
+				" Consider a shorter time range, a TTL based compaction strategy or a different data model.", tombstones, live),
+		})
+	}
+	return notices
+}
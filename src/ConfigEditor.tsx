@@ -18,6 +18,23 @@ export class ConfigEditor extends PureComponent<Props, State> {
     };
     onOptionsChange({ ...options, jsonData });
   };
+  onJsonDataChange = (key: keyof MyDataSourceOptions) => (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      [key]: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+  onJsonDataNumberChange = (key: keyof MyDataSourceOptions) => (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const value = parseInt(event.target.value, 10);
+    const jsonData = {
+      ...options.jsonData,
+      [key]: isNaN(value) ? undefined : value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
   onUserChange = (event: ChangeEvent<HTMLInputElement>) => {
     const { onOptionsChange, options } = this.props;
     onOptionsChange({
@@ -54,6 +71,30 @@ export class ConfigEditor extends PureComponent<Props, State> {
       },
     });
   };
+  onSecureChange = (key: keyof MySecureJsonData) => (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    onOptionsChange({
+      ...options,
+      secureJsonData: {
+        ...options.secureJsonData,
+        [key]: event.target.value,
+      },
+    });
+  };
+  onResetSecure = (key: keyof MySecureJsonData) => () => {
+    const { onOptionsChange, options } = this.props;
+    onOptionsChange({
+      ...options,
+      secureJsonFields: {
+        ...options.secureJsonFields,
+        [key]: false,
+      },
+      secureJsonData: {
+        ...options.secureJsonData,
+        [key]: '',
+      },
+    });
+  };
   onResetUser = () => {
     const { onOptionsChange, options } = this.props;
     onOptionsChange({
@@ -86,6 +127,268 @@ export class ConfigEditor extends PureComponent<Props, State> {
             placeholder="A host ip address"
           />
         </div>
+        <div className="gf-form">
+          <FormField
+            label="Consistency"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('consistency')}
+            value={jsonData.consistency || ''}
+            placeholder="QUORUM"
+            tooltip="Consistency level, e.g. ONE, LOCAL_QUORUM, QUORUM"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Allowed keyspaces"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('allowedKeyspaces')}
+            value={jsonData.allowedKeyspaces || ''}
+            placeholder="Comma separated, empty allows all"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Denied keyspaces"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('deniedKeyspaces')}
+            value={jsonData.deniedKeyspaces || ''}
+            placeholder="Comma separated"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Local datacenter"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('localDatacenter')}
+            value={jsonData.localDatacenter || ''}
+            placeholder="e.g. dc1"
+            tooltip="Prefer hosts in this datacenter"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Request timeout"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('timeout')}
+            value={jsonData.timeout || ''}
+            placeholder="600ms"
+            tooltip="How long to wait for a query response, e.g. 30s"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Connect timeout"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('connectTimeout')}
+            value={jsonData.connectTimeout || ''}
+            placeholder="600ms"
+            tooltip="How long to wait when connecting to a host, e.g. 5s"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Protocol version"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('protoVersion')}
+            value={jsonData.protoVersion || ''}
+            placeholder="auto"
+            tooltip="CQL protocol version, leave empty to autodetect"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Compression"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('compression')}
+            value={jsonData.compression || ''}
+            placeholder="none"
+            tooltip="Wire compression: none or snappy"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Connections per host"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('numConns')}
+            value={jsonData.numConns || ''}
+            placeholder="2"
+            tooltip="Number of connections opened to each host"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Page size"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('pageSize')}
+            value={jsonData.pageSize || ''}
+            placeholder="5000"
+            tooltip="Number of rows fetched per page"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Max rows"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('maxRows')}
+            value={jsonData.maxRows || ''}
+            placeholder="no limit"
+            tooltip="Queries stop reading their result after this many rows"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Retry policy"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('retryPolicy')}
+            value={jsonData.retryPolicy || ''}
+            placeholder="none"
+            tooltip="none, simple or exponential"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Retries"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('retryCount')}
+            value={jsonData.retryCount || ''}
+            placeholder="3"
+            tooltip="Number of retries of a failed query"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Speculative attempts"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('speculativeAttempts')}
+            value={jsonData.speculativeAttempts || ''}
+            placeholder="0"
+            tooltip="Extra attempts sent to another replica when a SELECT is slow"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Speculative delay"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('speculativeDelay')}
+            value={jsonData.speculativeDelay || ''}
+            placeholder="100ms"
+            tooltip="How long to wait before a speculative attempt"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Concurrent queries"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('maxConcurrentQueries')}
+            value={jsonData.maxConcurrentQueries || ''}
+            placeholder="8"
+            tooltip="Number of queries of a dashboard refresh run at once"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Max sessions"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('maxSessions')}
+            value={jsonData.maxSessions || ''}
+            placeholder="32"
+            tooltip="Number of driver sessions the datasource may open, one per queried host"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Idle timeout"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('idleTimeout')}
+            value={jsonData.idleTimeout || ''}
+            placeholder="30m"
+            tooltip="How long the datasource is unused before its connections and caches are released, 0 to keep them"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Memory budget (MB)"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataNumberChange('memoryBudgetMB')}
+            value={jsonData.memoryBudgetMB || ''}
+            placeholder="64"
+            tooltip="Memory the caches and connections of the datasource may hold before its caches are shrunk"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Decimal format"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('decimalFormat')}
+            value={jsonData.decimalFormat || ''}
+            placeholder="float"
+            tooltip="How varint and decimal columns are returned: float, string (their exact text) or both"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Query log level"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('queryLogLevel')}
+            value={jsonData.queryLogLevel || ''}
+            placeholder="debug"
+            tooltip="The level the executed queries are logged at, with their duration and rows: debug, info or off"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Allowed tables"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('allowedTables')}
+            value={jsonData.allowedTables || ''}
+            placeholder="keyspace.table, ..."
+            tooltip="Comma separated, empty allows all"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Denied tables"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('deniedTables')}
+            value={jsonData.deniedTables || ''}
+            placeholder="keyspace.table, ..."
+            tooltip="Comma separated"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Ad-hoc filter table"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onJsonDataChange('adHocTable')}
+            value={jsonData.adHocTable || ''}
+            placeholder="keyspace.table"
+            tooltip="Table ad-hoc filter variables list their keys and values from"
+          />
+        </div>
         <div className="gf-form">
           <SecretFormField
             isConfigured={(secureJsonFields && secureJsonFields.user) as boolean}
@@ -113,6 +416,31 @@ export class ConfigEditor extends PureComponent<Props, State> {
             />
           </div>
         </div>
+        <div className="gf-form">
+          <SecretFormField
+            isConfigured={(secureJsonFields && secureJsonFields.monitorUser) as boolean}
+            label="Monitor user"
+            labelWidth={6}
+            inputWidth={20}
+            onChange={this.onSecureChange('monitorUser')}
+            value={secureJsonData.monitorUser || ''}
+            onReset={this.onResetSecure('monitorUser')}
+            placeholder="Health check user"
+            tooltip="A low privilege user for the health checks, the user above by default"
+          />
+        </div>
+        <div className="gf-form">
+          <SecretFormField
+            isConfigured={(secureJsonFields && secureJsonFields.monitorPassword) as boolean}
+            value={secureJsonData.monitorPassword || ''}
+            label="Monitor password"
+            placeholder="Health check user password"
+            labelWidth={6}
+            inputWidth={20}
+            onReset={this.onResetSecure('monitorPassword')}
+            onChange={this.onSecureChange('monitorPassword')}
+          />
+        </div>
       </div>
     );
   }
@@ -1,18 +1,84 @@
-import { DataSourceInstanceSettings } from '@grafana/data';
+import { DataQueryRequest, DataQueryResponse, DataSourceInstanceSettings } from '@grafana/data';
+import { Observable } from 'rxjs';
 import { DataSourceWithBackend } from '@grafana/runtime';
-import { MyDataSourceOptions, MyQuery } from './types';
+import { MyDataSourceOptions, MyQuery, ScyllaAnnotation } from './types';
 import { getTemplateSrv } from '@grafana/runtime';
 
 export class DataSource extends DataSourceWithBackend<MyQuery, MyDataSourceOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<MyDataSourceOptions>) {
     super(instanceSettings);
   }
+  // query tags the queries with their app, dashboard and panel: the backend samples Explore queries
+  // and shares its query rate between dashboards
+  query(request: DataQueryRequest<MyQuery>): Observable<DataQueryResponse> {
+    return super.query({
+      ...request,
+      targets: request.targets.map(target => ({
+        ...target,
+        app: request.app,
+        dashboardId: request.dashboardId,
+        panelId: request.panelId,
+      })),
+    });
+  }
   applyTemplateVariables(query: MyQuery) {
     const templateSrv = getTemplateSrv();
     return {
       ...query,
       queryText: query.queryText ? templateSrv.replace(query.queryText) : '',
       queryHost: query.queryHost ? templateSrv.replace(query.queryHost) : '',
+      keyspace: query.keyspace ? templateSrv.replace(query.keyspace) : '',
+      table: query.table ? templateSrv.replace(query.table) : '',
+      filter: query.filter ? templateSrv.replace(query.filter) : '',
+      sessionId: query.sessionId ? templateSrv.replace(query.sessionId) : '',
+      templateParams: this.replaceParams(query.templateParams),
+      templateVariables: this.usedVariables(`${query.queryText || ''} ${query.queryHost || ''}`),
     };
   }
+  // validateQuery prepares the query without running it
+  validateQuery(queryText: string) {
+    return this.postResource('validate', queryText);
+  }
+  // saveAnnotation writes an annotation to the annotationsTable of the datasource
+  saveAnnotation(annotation: ScyllaAnnotation) {
+    return this.postResource('annotations', annotation);
+  }
+  // getFunctions lists the CQL functions the connected server supports
+  getFunctions() {
+    return this.getResource('functions');
+  }
+  // cancelQuery stops the running queries of the user with the refId
+  cancelQuery(refId: string) {
+    return this.postResource('cancel', { refId });
+  }
+  // getTagKeys lists the columns ad-hoc filters may use
+  getTagKeys() {
+    return this.getResource('tag-keys');
+  }
+  getTagValues(options: { key: string }) {
+    return this.getResource('tag-values', { key: options.key });
+  }
+  replaceParams(params?: Record<string, string>): Record<string, string> | undefined {
+    if (!params) {
+      return undefined;
+    }
+    const templateSrv = getTemplateSrv();
+    const res: Record<string, string> = {};
+    for (const name of Object.keys(params)) {
+      res[name] = templateSrv.replace(params[name]);
+    }
+    return res;
+  }
+  // usedVariables returns the values of the template variables referenced by text
+  usedVariables(text: string): Record<string, string> {
+    const templateSrv = getTemplateSrv();
+    const used: Record<string, string> = {};
+    for (const variable of templateSrv.getVariables()) {
+      const name = variable.name;
+      if (text.includes('$' + name) || text.includes('${' + name) || text.includes('[[' + name)) {
+        used[name] = templateSrv.replace('$' + name);
+      }
+    }
+    return used;
+  }
 }
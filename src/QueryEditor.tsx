@@ -4,9 +4,9 @@ import React, { ChangeEvent, PureComponent } from 'react';
 import { LegacyForms } from '@grafana/ui';
 import { QueryEditorProps } from '@grafana/data';
 import { DataSource } from './DataSource';
-import { defaultQuery, MyDataSourceOptions, MyQuery } from './types';
+import { BuilderQuery, defaultQuery, MyDataSourceOptions, MyQuery } from './types';
 
-const { FormField } = LegacyForms;
+const { FormField, Switch } = LegacyForms;
 
 type Props = QueryEditorProps<DataSource, MyQuery, MyDataSourceOptions>;
 
@@ -19,28 +19,120 @@ export class QueryEditor extends PureComponent<Props> {
     const { onChange, query } = this.props;
     onChange({ ...query, queryHost: event.target.value });
   };
+  onEditorModeChange = () => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, editorMode: query.editorMode === 'builder' ? 'code' : 'builder' });
+  };
+  onBuilderChange = (key: keyof BuilderQuery) => (event: ChangeEvent<HTMLInputElement>) => {
+    const { onChange, onRunQuery, query } = this.props;
+    const value = event.target.value;
+    let parsed: string | string[] | number = value;
+    if (key === 'columns') {
+      parsed = value
+        .split(',')
+        .map(c => c.trim())
+        .filter(c => c !== '');
+    } else if (key === 'limit') {
+      parsed = parseInt(value, 10) || 0;
+    }
+    onChange({ ...query, builder: { ...query.builder, [key]: parsed } });
+    onRunQuery();
+  };
+  renderBuilder(builder: BuilderQuery) {
+    return (
+      <>
+        <div className="gf-form">
+          <FormField
+            labelWidth={8}
+            inputWidth={12}
+            value={builder.keyspace || ''}
+            onChange={this.onBuilderChange('keyspace')}
+            label="Keyspace"
+          />
+          <FormField
+            labelWidth={8}
+            inputWidth={12}
+            value={builder.table || ''}
+            onChange={this.onBuilderChange('table')}
+            label="Table"
+          />
+          <FormField
+            labelWidth={8}
+            inputWidth={20}
+            value={(builder.columns || []).join(', ')}
+            onChange={this.onBuilderChange('columns')}
+            label="Columns"
+            tooltip="Comma separated, empty selects all columns"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            labelWidth={8}
+            inputWidth={12}
+            value={builder.timeColumn || ''}
+            onChange={this.onBuilderChange('timeColumn')}
+            label="Time column"
+            tooltip="Column used as the time axis and filtered by the dashboard time range"
+          />
+          <FormField
+            labelWidth={8}
+            inputWidth={12}
+            value={builder.timeUnit || ''}
+            onChange={this.onBuilderChange('timeUnit')}
+            label="Epoch unit"
+            tooltip="For numeric time columns: s, ms, us or ns. Leave empty for timestamp columns"
+          />
+          <FormField
+            labelWidth={8}
+            inputWidth={6}
+            value={builder.limit || ''}
+            onChange={this.onBuilderChange('limit')}
+            label="Limit"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            labelWidth={8}
+            inputWidth={30}
+            value={builder.where || ''}
+            onChange={this.onBuilderChange('where')}
+            label="Where"
+            tooltip="Additional CQL conditions"
+          />
+        </div>
+      </>
+    );
+  }
   render() {
     const query = defaults(this.props.query, defaultQuery);
-    const { queryText, queryHost } = query;
+    const { queryText, queryHost, editorMode } = query;
 
     return (
-      <div className="gf-form">
-        <FormField
-          labelWidth={8}
-          inputWidth={30}
-          value={queryText || ''}
-          onChange={this.onQueryTextChange}
-          label="Query Text"
-          tooltip="Enter a CQL query"
-        />
-        <FormField
-          labelWidth={8}
-          inputWidth={30}
-          value={queryHost || ''}
-          onChange={this.onQueryHostChange}
-          label="Host"
-          tooltip="Optional host"
-        />
+      <div className="gf-form-group">
+        <div className="gf-form">
+          <Switch label="Builder" checked={editorMode === 'builder'} onChange={this.onEditorModeChange} />
+        </div>
+        {editorMode === 'builder' && this.renderBuilder(query.builder || {})}
+        <div className="gf-form">
+          {editorMode !== 'builder' && (
+            <FormField
+              labelWidth={8}
+              inputWidth={30}
+              value={queryText || ''}
+              onChange={this.onQueryTextChange}
+              label="Query Text"
+              tooltip="Enter a CQL query"
+            />
+          )}
+          <FormField
+            labelWidth={8}
+            inputWidth={30}
+            value={queryHost || ''}
+            onChange={this.onQueryHostChange}
+            label="Host"
+            tooltip="Optional host"
+          />
+        </div>
       </div>
     );
   }
@@ -1,8 +1,94 @@
 import { DataQuery, DataSourceJsonData } from '@grafana/data';
 
+export interface BuilderFunction {
+  function: string;
+  args?: string[];
+  alias?: string;
+}
+
+export interface BuilderQuery {
+  keyspace?: string;
+  table?: string;
+  columns?: string[];
+  functions?: BuilderFunction[];
+  timeColumn?: string;
+  timeUnit?: string;
+  where?: string;
+  limit?: number;
+  allowFiltering?: boolean;
+}
+
 export interface MyQuery extends DataQuery {
   queryText?: string;
   queryHost?: string;
+  format?: 'table' | 'time_series' | 'logs';
+  editorMode?: 'code' | 'builder';
+  builder?: BuilderQuery;
+  templateVariables?: Record<string, string>;
+  dualFormat?: boolean;
+  queryType?: string;
+  bucket?: string;
+  bucketAggregation?: 'avg' | 'sum' | 'min' | 'max' | 'count';
+  timezone?: string;
+  keyspace?: string;
+  table?: string;
+  template?: string;
+  templateParams?: Record<string, string>;
+  emptyResult?: 'frame' | 'none' | 'notice';
+  jsonFields?: Array<{ column: string; path: string; name?: string }>;
+  pageSize?: number;
+  column?: string;
+  filter?: string;
+  limit?: number;
+  maxRows?: number;
+  rawPoints?: boolean;
+  noCache?: boolean;
+  keepOrder?: boolean;
+  ranges?: number;
+  sampleRanges?: number;
+  rangeTimeout?: string;
+  dashboardId?: number;
+  panelId?: number;
+  sessionId?: string;
+  tracing?: boolean;
+  fieldOrder?: 'keys' | 'query';
+  sortByTime?: boolean;
+  timeShift?: string;
+  customPayload?: boolean;
+  timeColumn?: string;
+  timeUnit?: 's' | 'ms' | 'us' | 'ns';
+  gapFill?: 'null' | 'zero' | 'previous';
+  gapInterval?: string;
+  app?: string;
+  fullResult?: boolean;
+  labelColumns?: string[];
+  partitionBy?: string[];
+  collectionFormat?: 'json' | 'join';
+  explodeMaps?: boolean;
+  tuplesAsJSON?: boolean;
+  explodeVectors?: boolean;
+  columnTypes?: Record<string, 'number' | 'time' | 'string' | 'boolean'>;
+  coerceNumbers?: boolean;
+  decimalFormat?: 'float' | 'string' | 'both';
+  blobFormat?: 'hex' | 'base64' | 'text' | 'length';
+  timeuuidFormat?: 'uuid' | 'time' | 'both';
+  convertToWide?: boolean;
+  fill?: 'previous' | 'null' | 'value';
+  fillValue?: number;
+  alias?: string;
+  logs?: { timestamp?: string; body?: string; level?: string; labels?: string[] };
+}
+
+/**
+ * An annotation written back to the annotationsTable, times are epoch milliseconds
+ */
+export interface ScyllaAnnotation {
+  dashboardUID?: string;
+  panelId?: number;
+  time: number;
+  timeEnd?: number;
+  text?: string;
+  tags?: string[];
 }
 
 export const defaultQuery: Partial<MyQuery> = {
@@ -15,6 +101,52 @@ export const defaultQuery: Partial<MyQuery> = {
  */
 export interface MyDataSourceOptions extends DataSourceJsonData {
   host?: string;
+  allowedKeyspaces?: string;
+  deniedKeyspaces?: string;
+  consistency?: string;
+  schemaCacheTTL?: string;
+  localDatacenter?: string;
+  disableTokenAware?: boolean;
+  timeout?: string;
+  connectTimeout?: string;
+  protoVersion?: number;
+  compression?: 'none' | 'snappy';
+  numConns?: number;
+  retryPolicy?: 'none' | 'simple' | 'exponential';
+  retryCount?: number;
+  retryMinInterval?: string;
+  retryMaxInterval?: string;
+  speculativeAttempts?: number;
+  speculativeDelay?: string;
+  rewriteRules?: Array<{ pattern: string; replacement: string }>;
+  queryAllowPatterns?: string[];
+  queryDenyPatterns?: string[];
+  allowedTables?: string;
+  deniedTables?: string;
+  tls?: boolean;
+  tlsSkipVerify?: boolean;
+  adHocTable?: string;
+  queryTemplates?: Array<{ name: string; query: string; defaults?: Record<string, string> }>;
+  emptyResult?: 'frame' | 'none' | 'notice';
+  decimalFormat?: 'float' | 'string' | 'both';
+  queryLogLevel?: 'debug' | 'info' | 'off';
+  maxConcurrentQueries?: number;
+  pageSize?: number;
+  maxRows?: number;
+  cacheDir?: string;
+  latencyProbeInterval?: string;
+  resultCacheTTL?: string;
+  resultCacheSize?: number;
+  annotationsTable?: string;
+  annotationsRole?: 'Viewer' | 'Editor' | 'Admin';
+  dashboardQueryRate?: number;
+  dashboardQueryBurst?: number;
+  exploreLimit?: number;
+  probeTransport?: boolean;
+  monitoringLinks?: Array<{ title: string; url: string }>;
+  maxSessions?: number;
+  idleTimeout?: string;
+  memoryBudgetMB?: number;
 }
 
 /**
@@ -23,4 +155,9 @@ export interface MyDataSourceOptions extends DataSourceJsonData {
 export interface MySecureJsonData {
   user?: string;
   password?: string;
+  monitorUser?: string;
+  monitorPassword?: string;
+  tlsCACert?: string;
+  tlsClientCert?: string;
+  tlsClientKey?: string;
 }